@@ -0,0 +1,552 @@
+/*
+Copyright © 2024 JankariTech Pvt. Ltd. info@jankaritech.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func validateUrl(input string) error {
+	parsedUrl, err := url.Parse(input)
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+		return errors.New("Invalid URL")
+	}
+	return nil
+}
+
+func validateNotEmpty(input string) error {
+	if strings.TrimSpace(input) == "" {
+		return errors.New("Cannot be empty")
+	}
+	return nil
+}
+
+// configFilePath returns the file given with the --config flag or the default config file in the home folder
+func configFilePath() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".OpenProjectTmetricIntegration.yaml"), nil
+}
+
+// promptOpenProjectSettings asks for the URL and the token of OpenProject till they can be used to log in
+func promptOpenProjectSettings(config *config.Config) error {
+	openProjectUrl := strings.TrimSuffix(config.OpenProjectUrl, "/")
+	if openProjectUrl == "" {
+		openProjectUrl = "https://community.openproject.org"
+	}
+	for {
+		urlPrompt := promptui.Prompt{
+			Label:    "OpenProject URL",
+			Default:  openProjectUrl,
+			Validate: validateUrl,
+		}
+		// the URL is kept for the next try, in case the token does not work
+		var err error
+		openProjectUrl, err = urlPrompt.Run()
+		if err != nil {
+			return fmt.Errorf("prompt failed: %v", err)
+		}
+		tokenPrompt := promptui.Prompt{
+			Label:    "OpenProject API token (My account => Access tokens)",
+			Mask:     '*',
+			Validate: validateNotEmpty,
+		}
+		openProjectToken, err := tokenPrompt.Run()
+		if err != nil {
+			return fmt.Errorf("prompt failed: %v", err)
+		}
+
+		config.OpenProjectUrl = openProjectUrl
+		config.OpenProjectToken = strings.TrimSpace(openProjectToken)
+		user, err := openproject.GetCurrentUser(config)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "could not log in to OpenProject, please try again\n%v\n", err)
+			continue
+		}
+		fmt.Printf("logged in to OpenProject as '%v'\n", user.Name)
+		return nil
+	}
+}
+
+// promptTmetricSettings asks for the token of tmetric till it can be used to log in
+func promptTmetricSettings(config *config.Config) (tmetric.User, error) {
+	for {
+		tokenPrompt := promptui.Prompt{
+			Label:    "tmetric API token (My profile => API access tokens)",
+			Mask:     '*',
+			Validate: validateNotEmpty,
+		}
+		tmetricToken, err := tokenPrompt.Run()
+		if err != nil {
+			return tmetric.User{}, fmt.Errorf("prompt failed: %v", err)
+		}
+
+		config.TmetricToken = strings.TrimSpace(tmetricToken)
+		tmetricUser, err := tmetric.NewUser(config)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "could not log in to tmetric, please try again\n%v\n", err)
+			continue
+		}
+		fmt.Printf("logged in to tmetric as '%v'\n", tmetricUser.Name)
+		return tmetricUser, nil
+	}
+}
+
+// selectTmetricClient lets the user pick the client whose time entries are transferred to OpenProject
+func selectTmetricClient(config *config.Config, tmetricUser tmetric.User) error {
+	clients, err := tmetric.GetAllClients(config, tmetricUser)
+	if err != nil {
+		return err
+	}
+	if len(clients) == 0 {
+		return fmt.Errorf("there are no clients in tmetric, ask the admin of the account to create one")
+	}
+	var clientNames []string
+	cursorPosition := 0
+	for i, client := range clients {
+		clientNames = append(clientNames, client.Name)
+		if client.Id == config.ClientIdInTmetric {
+			cursorPosition = i
+		}
+	}
+	prompt := promptui.Select{
+		Label:     "Select the tmetric client whose time entries should be transferred to OpenProject",
+		Items:     clientNames,
+		CursorPos: cursorPosition,
+		Size:      10,
+	}
+	selected, _, err := prompt.Run()
+	if err != nil {
+		return fmt.Errorf("prompt failed: %v", err)
+	}
+	config.ClientIdInTmetric = clients[selected].Id
+	return nil
+}
+
+// selectTmetricDummyProject lets the user pick the project in which the dummy entries are created,
+// that are needed to create tasks in tmetric that are linked to OpenProject
+func selectTmetricDummyProject(config *config.Config, tmetricUser tmetric.User) error {
+	projects, err := tmetric.GetAllProjects(config, tmetricUser)
+	if err != nil {
+		return err
+	}
+	if len(projects) == 0 {
+		return fmt.Errorf("there are no projects in tmetric, ask the admin of the account to create the dummy project")
+	}
+	var projectNames []string
+	cursorPosition := 0
+	for i, project := range projects {
+		projectNames = append(projectNames, project.Name)
+		if project.Id == config.TmetricDummyProjectId {
+			cursorPosition = i
+		}
+	}
+	prompt := promptui.Select{
+		Label:     "Select the dummy project in tmetric",
+		Items:     projectNames,
+		CursorPos: cursorPosition,
+		Size:      10,
+	}
+	selected, _, err := prompt.Run()
+	if err != nil {
+		return fmt.Errorf("prompt failed: %v", err)
+	}
+	config.TmetricDummyProjectId = projects[selected].Id
+	return nil
+}
+
+type tokenBackend int
+
+const (
+	tokenBackendConfigFile tokenBackend = iota
+	tokenBackendTokenFiles
+	tokenBackendCredentialHelper
+)
+
+// defaultCredentialHelper returns the git credential helper that is usually available on the OS
+func defaultCredentialHelper() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "git credential-osxkeychain"
+	case "windows":
+		return "git credential-manager"
+	default:
+		return "git credential-libsecret"
+	}
+}
+
+// selectTokenBackend asks where the tokens should be stored and for the settings that storage needs
+func selectTokenBackend(config *config.Config) (tokenBackend, error) {
+	cursorPosition := tokenBackendConfigFile
+	if config.OpenProjectTokenFile != "" || config.TmetricTokenFile != "" {
+		cursorPosition = tokenBackendTokenFiles
+	}
+	if config.CredentialHelper != "" {
+		cursorPosition = tokenBackendCredentialHelper
+	}
+	prompt := promptui.Select{
+		Label: "Where should the tokens be stored",
+		Items: []string{
+			"in the config file",
+			"in separate files that only you can read",
+			"with a git credential helper, e.g. in the keyring of the OS",
+		},
+		CursorPos: int(cursorPosition),
+	}
+	selected, _, err := prompt.Run()
+	if err != nil {
+		return tokenBackendConfigFile, fmt.Errorf("prompt failed: %v", err)
+	}
+
+	backend := tokenBackend(selected)
+	switch backend {
+	case tokenBackendTokenFiles:
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return backend, err
+		}
+		prefix := ".OpenProjectTmetricIntegration."
+		if config.Profile != "" {
+			prefix += strings.ToLower(config.Profile) + "."
+		}
+		for _, tokenFile := range []struct {
+			label string
+			path  *string
+			name  string
+		}{
+			{"File for the OpenProject token", &config.OpenProjectTokenFile, "openproject.token"},
+			{"File for the tmetric token", &config.TmetricTokenFile, "tmetric.token"},
+		} {
+			defaultPath := *tokenFile.path
+			if defaultPath == "" {
+				defaultPath = filepath.Join(home, prefix+tokenFile.name)
+			}
+			pathPrompt := promptui.Prompt{Label: tokenFile.label, Default: defaultPath, Validate: validateNotEmpty}
+			path, err := pathPrompt.Run()
+			if err != nil {
+				return backend, fmt.Errorf("prompt failed: %v", err)
+			}
+			*tokenFile.path = strings.TrimSpace(path)
+		}
+	case tokenBackendCredentialHelper:
+		defaultHelper := config.CredentialHelper
+		if defaultHelper == "" {
+			defaultHelper = defaultCredentialHelper()
+		}
+		helperPrompt := promptui.Prompt{Label: "Credential helper", Default: defaultHelper, Validate: validateNotEmpty}
+		helper, err := helperPrompt.Run()
+		if err != nil {
+			return backend, fmt.Errorf("prompt failed: %v", err)
+		}
+		config.CredentialHelper = strings.TrimSpace(helper)
+	}
+	return backend, nil
+}
+
+// storeTokens writes the tokens to the token files or the credential helper,
+// tokens that are stored in the config file are written together with the other settings
+func storeTokens(config *config.Config, backend tokenBackend) error {
+	switch backend {
+	case tokenBackendTokenFiles:
+		return config.WriteTokenFiles()
+	case tokenBackendCredentialHelper:
+		return config.StoreTokensWithCredentialHelper()
+	}
+	return nil
+}
+
+// findSetting returns the index of the key in the content of the mapping node, in any spelling,
+// viper reads the keys case-insensitive. It's -1 if the key is not set
+func findSetting(settings *yaml.Node, key string) int {
+	for i := 0; i+1 < len(settings.Content); i += 2 {
+		if strings.EqualFold(settings.Content[i].Value, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeSetting removes every spelling of the key from the mapping node
+func removeSetting(settings *yaml.Node, key string) {
+	for i := findSetting(settings, key); i != -1; i = findSetting(settings, key) {
+		settings.Content = slices.Delete(settings.Content, i, i+2)
+	}
+}
+
+// findSection returns the mapping node of the section at the given path of the config file, or nil if it is not set
+func findSection(settings *yaml.Node, path []string) *yaml.Node {
+	for _, section := range path {
+		i := findSetting(settings, section)
+		if i == -1 || settings.Content[i+1].Kind != yaml.MappingNode {
+			return nil
+		}
+		settings = settings.Content[i+1]
+	}
+	return settings
+}
+
+// setSetting sets the value of a key in the section at the given path of the config file. Any other spelling of the
+// sections and the key that differs only in the case is replaced. The comments of the settings are kept
+func setSetting(settings *yaml.Node, path []string, key string, value any) {
+	for _, section := range path {
+		i := findSetting(settings, section)
+		if i == -1 {
+			settings.Content = append(
+				settings.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: section},
+				&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"},
+			)
+			settings = settings.Content[len(settings.Content)-1]
+			continue
+		}
+		keyNode, sectionNode := settings.Content[i], settings.Content[i+1]
+		keyNode.Value = section
+		// a section that is empty in the file, e.g. 'profiles:' without any profile, is not a mapping yet
+		if sectionNode.Kind != yaml.MappingNode {
+			*sectionNode = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", LineComment: sectionNode.LineComment}
+		}
+		settings.Content = slices.Delete(settings.Content, i, i+2)
+		removeSetting(settings, section)
+		settings.Content = slices.Insert(settings.Content, i, keyNode, sectionNode)
+		settings = sectionNode
+	}
+
+	var valueNode yaml.Node
+	// the settings are strings and numbers, encoding them cannot fail
+	_ = valueNode.Encode(value)
+	i := findSetting(settings, key)
+	if i == -1 {
+		settings.Content = append(
+			settings.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &valueNode,
+		)
+		return
+	}
+	keyNode, existingValueNode := settings.Content[i], settings.Content[i+1]
+	keyNode.Value = key
+	valueNode.HeadComment = existingValueNode.HeadComment
+	valueNode.LineComment = existingValueNode.LineComment
+	valueNode.FootComment = existingValueNode.FootComment
+	*existingValueNode = valueNode
+	settings.Content = slices.Delete(settings.Content, i, i+2)
+	removeSetting(settings, key)
+	settings.Content = slices.Insert(settings.Content, i, keyNode, existingValueNode)
+}
+
+// deleteSetting removes a key in the section at the given path of the config file, in any spelling
+func deleteSetting(settings *yaml.Node, path []string, key string) {
+	section := findSection(settings, path)
+	if section != nil {
+		removeSetting(section, key)
+	}
+}
+
+// hasSetting tells if the key is set in the section at the given path of the config file, in any spelling
+func hasSetting(settings *yaml.Node, path []string, key string) bool {
+	section := findSection(settings, path)
+	return section != nil && findSetting(section, key) != -1
+}
+
+// writeConfigFile writes the settings of the wizard to the config file, the tokens only if they are stored there.
+// Any other setting that is already in the file is kept
+func writeConfigFile(path string, config *config.Config, backend tokenBackend) error {
+	// the file is edited as YAML nodes, so that the comments and the order of the settings are kept
+	var document yaml.Node
+	content, err := os.ReadFile(path)
+	if err == nil {
+		err = yaml.Unmarshal(content, &document)
+		if err != nil {
+			return fmt.Errorf("could not parse the existing config file '%v': %v", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not read the existing config file '%v': %v", path, err)
+	}
+	// an empty file has no document yet
+	if document.Kind == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	settings := document.Content[0]
+	if settings.Kind != yaml.MappingNode {
+		return fmt.Errorf("could not parse the existing config file '%v': the settings are not a mapping", path)
+	}
+
+	// the settings of a profile are written into the profile, the top level settings are left as they are
+	var profilePath []string
+	if config.Profile != "" {
+		profilePath = []string{"profiles", config.Profile}
+	}
+	section := func(name string) []string {
+		return append(slices.Clone(profilePath), name)
+	}
+	setSetting(settings, section("openproject"), "url", config.OpenProjectUrl)
+	setSetting(settings, section("tmetric"), "clientId", config.ClientIdInTmetric)
+	setSetting(settings, section("tmetric"), "dummyProjectId", config.TmetricDummyProjectId)
+
+	// only the selected storage of the tokens is left in the config file, because the others would take precedence
+	for _, service := range []string{"openproject", "tmetric"} {
+		deleteSetting(settings, section(service), "token")
+		deleteSetting(settings, section(service), "tokenFile")
+	}
+	deleteSetting(settings, profilePath, "credentialHelper")
+	// a profile would still use the storages of the top level, and a credential helper or a token file
+	// is asked before the token in the config file, so the ones the profile does not use are set to be empty
+	if config.Profile != "" {
+		if hasSetting(settings, nil, "credentialHelper") {
+			setSetting(settings, profilePath, "credentialHelper", "")
+		}
+		for _, service := range []string{"openproject", "tmetric"} {
+			for _, key := range []string{"token", "tokenFile"} {
+				if hasSetting(settings, []string{service}, key) {
+					setSetting(settings, section(service), key, "")
+				}
+			}
+		}
+	}
+	switch backend {
+	case tokenBackendConfigFile:
+		setSetting(settings, section("openproject"), "token", config.OpenProjectToken)
+		setSetting(settings, section("tmetric"), "token", config.TmetricToken)
+	case tokenBackendTokenFiles:
+		setSetting(settings, section("openproject"), "tokenFile", config.OpenProjectTokenFile)
+		setSetting(settings, section("tmetric"), "tokenFile", config.TmetricTokenFile)
+	case tokenBackendCredentialHelper:
+		setSetting(settings, profilePath, "credentialHelper", config.CredentialHelper)
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&document)
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err != nil {
+		return err
+	}
+	content = buffer.Bytes()
+	// the file contains the tokens, so nobody else should be able to read it
+	err = os.WriteFile(path, content, 0600)
+	if err != nil {
+		return fmt.Errorf("could not write the config file '%v': %v", path, err)
+	}
+	return os.Chmod(path, 0600)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "manage the configuration",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("please supply a subcommand (init)")
+	},
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "create the config file interactively",
+	Long: `Asks for the URL and the tokens of OpenProject and tmetric and checks them against the APIs.
+Then the client and the dummy project can be selected from the ones existing in tmetric.
+The tokens can be stored in the config file, in separate files that only the user can read,
+or with a git credential helper. The result is written to the config file,
+or into a profile of the config file if --profile is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := configFilePath()
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		// the current config is most likely incomplete, its values are only used as defaults
+		config, _ := loadProfile(profileName)
+
+		err = promptOpenProjectSettings(config)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		tmetricUser, err := promptTmetricSettings(config)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = selectTmetricClient(config, tmetricUser)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = selectTmetricDummyProject(config, tmetricUser)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		backend, err := selectTokenBackend(config)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			prompt := promptui.Prompt{
+				Label:     fmt.Sprintf("Update the existing config file '%v'", path),
+				IsConfirm: true,
+			}
+			confirmation, _ := prompt.Run()
+			if strings.ToLower(confirmation) != "y" {
+				fmt.Println("config file not changed")
+				return
+			}
+		}
+		err = storeTokens(config, backend)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = writeConfigFile(path, config, backend)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		if config.Profile != "" {
+			fmt.Printf("config of the profile '%v' written to '%v'\n", config.Profile, path)
+		} else {
+			fmt.Printf("config written to '%v'\n", path)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configInitCmd)
+}
@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// parseSettings returns the mapping node of the settings in the YAML content
+func parseSettings(t *testing.T, content string) *yaml.Node {
+	var document yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(content), &document))
+	return document.Content[0]
+}
+
+// renderSettings returns the settings of the mapping node as YAML
+func renderSettings(t *testing.T, settings *yaml.Node) string {
+	content, err := yaml.Marshal(settings)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func TestSetSetting(t *testing.T) {
+	settings := parseSettings(t, `OpenProject:
+    URL: https://old.example.com # the old instance
+    token: secret
+http:
+    retries: 5
+`)
+	setSetting(settings, []string{"openproject"}, "url", "https://new.example.com")
+	setSetting(settings, []string{"profiles", "clientA", "tmetric"}, "clientId", 3)
+	assert.Equal(t, `openproject:
+    url: https://new.example.com # the old instance
+    token: secret
+http:
+    retries: 5
+profiles:
+    clientA:
+        tmetric:
+            clientId: 3
+`, renderSettings(t, settings))
+}
+
+func TestSetSetting_emptySection(t *testing.T) {
+	settings := parseSettings(t, "profiles:\n")
+	setSetting(settings, []string{"profiles", "clientA"}, "credentialHelper", "")
+	assert.Equal(t, "profiles:\n    clientA:\n        credentialHelper: \"\"\n", renderSettings(t, settings))
+}
+
+func TestDeleteSetting(t *testing.T) {
+	settings := parseSettings(t, `openproject:
+    url: https://openproject.example.com
+    Token: secret
+tmetric:
+    token: secret
+`)
+	deleteSetting(settings, []string{"OpenProject"}, "token")
+	// a section that does not exist is not created
+	deleteSetting(settings, []string{"profiles", "clientA"}, "credentialHelper")
+	assert.Equal(t, `openproject:
+    url: https://openproject.example.com
+tmetric:
+    token: secret
+`, renderSettings(t, settings))
+}
+
+func TestWriteConfigFile(t *testing.T) {
+	existingContent := `openproject:
+  url: https://old.example.com
+  Token: oldToken
+tmetric:
+  clientId: 1
+  dummyProjectId: 2
+  filter:
+    projects: [Website]
+activities:
+  default: Development
+profiles:
+  clientA:
+    openproject:
+      url: https://clienta.example.com
+      tokenFile: ~/clienta.token
+  clientB:
+    tmetric:
+      clientId: 7
+`
+	tests := []struct {
+		name         string
+		existing     bool
+		config       config.Config
+		backend      tokenBackend
+		wantSettings map[string]any
+	}{
+		{
+			name:     "new config file",
+			existing: false,
+			config: config.Config{
+				OpenProjectUrl:        "https://openproject.example.com",
+				OpenProjectToken:      "openProjectToken",
+				TmetricToken:          "tmetricToken",
+				ClientIdInTmetric:     3,
+				TmetricDummyProjectId: 4,
+			},
+			backend: tokenBackendConfigFile,
+			wantSettings: map[string]any{
+				"openproject": map[string]any{"url": "https://openproject.example.com", "token": "openProjectToken"},
+				"tmetric":     map[string]any{"clientId": 3, "dummyProjectId": 4, "token": "tmetricToken"},
+			},
+		},
+		{
+			name:     "top level settings",
+			existing: true,
+			config: config.Config{
+				OpenProjectUrl:        "https://openproject.example.com",
+				OpenProjectToken:      "openProjectToken",
+				TmetricToken:          "tmetricToken",
+				ClientIdInTmetric:     3,
+				TmetricDummyProjectId: 4,
+			},
+			backend: tokenBackendConfigFile,
+			wantSettings: map[string]any{
+				"openproject": map[string]any{"url": "https://openproject.example.com", "token": "openProjectToken"},
+				"tmetric": map[string]any{
+					"clientId":       3,
+					"dummyProjectId": 4,
+					"token":          "tmetricToken",
+					"filter":         map[string]any{"projects": []any{"Website"}},
+				},
+				"activities": map[string]any{"default": "Development"},
+				"profiles": map[string]any{
+					"clientA": map[string]any{
+						"openproject": map[string]any{
+							"url": "https://clienta.example.com", "tokenFile": "~/clienta.token",
+						},
+					},
+					"clientB": map[string]any{"tmetric": map[string]any{"clientId": 7}},
+				},
+			},
+		},
+		{
+			name:     "profile with credential helper",
+			existing: true,
+			config: config.Config{
+				Profile:               "clientA",
+				OpenProjectUrl:        "https://clienta.example.com",
+				CredentialHelper:      "git credential-libsecret",
+				ClientIdInTmetric:     8,
+				TmetricDummyProjectId: 9,
+			},
+			backend: tokenBackendCredentialHelper,
+			wantSettings: map[string]any{
+				"openproject": map[string]any{"url": "https://old.example.com", "Token": "oldToken"},
+				"tmetric": map[string]any{
+					"clientId":       1,
+					"dummyProjectId": 2,
+					"filter":         map[string]any{"projects": []any{"Website"}},
+				},
+				"activities": map[string]any{"default": "Development"},
+				"profiles": map[string]any{
+					"clientA": map[string]any{
+						"openproject":      map[string]any{"url": "https://clienta.example.com", "token": ""},
+						"tmetric":          map[string]any{"clientId": 8, "dummyProjectId": 9},
+						"credentialHelper": "git credential-libsecret",
+					},
+					"clientB": map[string]any{"tmetric": map[string]any{"clientId": 7}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if tt.existing {
+				assert.NoError(t, os.WriteFile(path, []byte(existingContent), 0600))
+			}
+
+			err := writeConfigFile(path, &tt.config, tt.backend)
+			assert.NoError(t, err)
+			content, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			var settings map[string]any
+			assert.NoError(t, yaml.Unmarshal(content, &settings))
+			assert.Equal(t, tt.wantSettings, settings)
+			if runtime.GOOS != "windows" {
+				info, err := os.Stat(path)
+				assert.NoError(t, err)
+				assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestWriteConfigFile_keepsCommentsAndOrder(t *testing.T) {
+	existingContent := `# settings of the OpenProject tmetric integration
+tmetric:
+  # the client of the company
+  clientId: 1 # see the URL of the client in tmetric
+  dummyProjectId: 2
+activities:
+  default: Development
+openproject:
+  url: https://old.example.com
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(existingContent), 0600))
+
+	err := writeConfigFile(path, &config.Config{
+		OpenProjectUrl:        "https://openproject.example.com",
+		CredentialHelper:      "git credential-libsecret",
+		ClientIdInTmetric:     3,
+		TmetricDummyProjectId: 4,
+	}, tokenBackendCredentialHelper)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `# settings of the OpenProject tmetric integration
+tmetric:
+  # the client of the company
+  clientId: 3 # see the URL of the client in tmetric
+  dummyProjectId: 4
+activities:
+  default: Development
+openproject:
+  url: https://openproject.example.com
+credentialHelper: git credential-libsecret
+`, string(content))
+}
+
+func TestWriteConfigFile_profileSwitchesToConfigFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	// the credential helper of the top level does not know any token and fails
+	existingContent := `credentialHelper: "false"
+openproject:
+  url: https://openproject.example.com
+tmetric:
+  clientId: 1
+  dummyProjectId: 2
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(existingContent), 0600))
+
+	err := writeConfigFile(path, &config.Config{
+		Profile:               "clientA",
+		OpenProjectUrl:        "https://clienta.example.com",
+		OpenProjectToken:      "clientAToken",
+		TmetricToken:          "tmetricToken",
+		ClientIdInTmetric:     3,
+		TmetricDummyProjectId: 4,
+	}, tokenBackendConfigFile)
+	assert.NoError(t, err)
+
+	viper.Reset()
+	viper.SetConfigFile(path)
+	assert.NoError(t, viper.ReadInConfig())
+	loadedConfig, err := config.LoadProfile("clientA")
+	assert.NoError(t, err)
+	assert.Empty(t, loadedConfig.CredentialHelper)
+	assert.Equal(t, "clientAToken", loadedConfig.OpenProjectToken)
+	assert.Equal(t, "tmetricToken", loadedConfig.TmetricToken)
+}
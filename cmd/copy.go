@@ -18,16 +18,34 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/state"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var dryRun bool
+var keepGoing bool
+var parallelTransfers int
+
+// upper limit for the number of transfers that are started per second when transferring in parallel
+const maxTransfersPerSecond = 5
+
+var updateTransferred bool
+
 func checkTmetricEntries(tmetricUser tmetric.User, config *config.Config) ([]tmetric.TimeEntry, error) {
 	spinner := newSpinner()
 	defer spinner.Stop()
@@ -50,32 +68,31 @@ func checkTmetricEntries(tmetricUser tmetric.User, config *config.Config) ([]tme
 		)
 	}
 
-	filteredEntries := tmetric.GetEntriesNotTransferredToOpenProject(
-		timeEntries, config.TmetricTagTransferredToOpenProject,
-	)
-
 	spinner.FinalMSG = "✔️\n"
-	return filteredEntries, err
+	return timeEntries, err
 }
 
-func transferEntryToOpenProject(
-	tmetricTimeEntry tmetric.TimeEntry, tmetricUser tmetric.User, config *config.Config,
-) error {
-	spinner := newSpinner()
-	defer spinner.Stop()
-	spinner.FinalMSG = "❌\n"
-	spinner.Prefix = fmt.Sprintf(
-		"Transferring data to OpenProject. Project: '%v', Note: '%v', Start: '%v' ", tmetricTimeEntry.Project.Name, tmetricTimeEntry.Note, tmetricTimeEntry.StartTime,
-	)
-	spinner.Restart()
+// plannedTransfer holds a tmetric time entry together with everything that was resolved
+// to create its counterpart in OpenProject
+type plannedTransfer struct {
+	tmetricTimeEntry     tmetric.TimeEntry
+	activity             openproject.Activity
+	openProjectTimeEntry openproject.TimeEntry
+}
+
+// planTransfer resolves the work package, the activity and the duration of a tmetric time entry
+// without writing anything to OpenProject or tmetric
+func planTransfer(
+	tmetricTimeEntry tmetric.TimeEntry, activities *openproject.ActivityCache, config *config.Config,
+) (plannedTransfer, error) {
 	issueId, err := tmetricTimeEntry.GetIssueIdAsInt()
 	if err != nil {
-		return err
+		return plannedTransfer{}, err
 	}
 
 	workType, err := tmetricTimeEntry.GetWorkType()
 	if err != nil {
-		return fmt.Errorf(
+		return plannedTransfer{}, fmt.Errorf(
 			"Error with time entry '%v' in project '%v'\nError: %v\n",
 			tmetricTimeEntry.Note,
 			tmetricTimeEntry.Project.Name,
@@ -83,10 +100,10 @@ func transferEntryToOpenProject(
 		)
 	}
 
-	activity, err := openproject.NewActivityFromWorkType(*config, issueId, workType)
+	activity, err := activities.NewActivityFromWorkType(*config, issueId, workType)
 	if err != nil {
-		return fmt.Errorf(
-			"Error with time entry '%v' in project '%v'\nError: %v\n",
+		return plannedTransfer{}, fmt.Errorf(
+			"Error with time entry '%v' in project '%v'\nError: %w\n",
 			tmetricTimeEntry.Note,
 			tmetricTimeEntry.Project.Name,
 			err,
@@ -95,36 +112,760 @@ func transferEntryToOpenProject(
 
 	openProjectTimeEntry, err := tmetricTimeEntry.ConvertToOpenProjectTimeEntry(activity)
 	if err != nil {
-		return fmt.Errorf(
+		return plannedTransfer{}, fmt.Errorf(
 			"could not convert time entry '%v' in project '%v' started at '%v' from tmetric to OpenProject\n"+
 				"Error: %v\n",
 			tmetricTimeEntry.Note, tmetricTimeEntry.Project, tmetricTimeEntry.StartTime, err,
 		)
 	}
+	return plannedTransfer{
+		tmetricTimeEntry:     tmetricTimeEntry,
+		activity:             activity,
+		openProjectTimeEntry: openProjectTimeEntry,
+	}, nil
+}
+
+// existingOpenProjectEntries holds the time entries that already exist in OpenProject per work package and day.
+// Every entry can only be claimed once, so that identical entries in tmetric are not all matched to the same
+// entry in OpenProject
+type existingOpenProjectEntries struct {
+	mutex   sync.Mutex
+	entries map[string][]openproject.TimeEntry
+}
+
+func newExistingOpenProjectEntries() *existingOpenProjectEntries {
+	return &existingOpenProjectEntries{entries: map[string][]openproject.TimeEntry{}}
+}
+
+// claimMatching looks up the entries of the user for the work package and day of the given entry
+// and returns and claims the one that matches it, if there is any.
+// Entries that the state file links to another tmetric entry are never claimed
+func (e *existingOpenProjectEntries) claimMatching(
+	timeEntry openproject.TimeEntry, tmetricTimeEntry tmetric.TimeEntry, transfers *state.Store, config *config.Config,
+) (openproject.TimeEntry, bool, error) {
+	workPackageId := path.Base(timeEntry.Links.WorkPackage.Href)
+	key := workPackageId + "/" + timeEntry.SpentOn
+	e.mutex.Lock()
+	_, loaded := e.entries[key]
+	e.mutex.Unlock()
+	// the lock is not held during the request, so that the other workers are not blocked by it
+	var fetchedEntries []openproject.TimeEntry
+	if !loaded {
+		var err error
+		fetchedEntries, err = openproject.GetAllTimeEntries(
+			config, openproject.User{}, timeEntry.SpentOn, timeEntry.SpentOn, []any{workPackageId},
+		)
+		if err != nil {
+			return openproject.TimeEntry{}, false, err
+		}
+	}
 
-	err = openProjectTimeEntry.Save(*config)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	entries, loaded := e.entries[key]
+	// another worker might have loaded the entries in the meantime and claimed some of them already
+	if !loaded {
+		entries = fetchedEntries
+		e.entries[key] = entries
+	}
+	for index, existingEntry := range entries {
+		if !existingEntry.Matches(timeEntry) {
+			continue
+		}
+		recordedTransfer, recorded := transfers.FindByOpenProjectEntry(existingEntry.Id)
+		if recorded && !transferBelongsToEntry(recordedTransfer, tmetricTimeEntry) {
+			continue
+		}
+		e.entries[key] = append(entries[:index:index], entries[index+1:]...)
+		return existingEntry, true, nil
+	}
+	return openproject.TimeEntry{}, false, nil
+}
+
+type transferStatus string
+
+const (
+	transferCreated transferStatus = "transferred"
+	transferSkipped transferStatus = "skipped"
+	transferFailed  transferStatus = "failed"
+)
+
+// transferResult is the outcome of the transfer of a single tmetric entry
+type transferResult struct {
+	tmetricTimeEntry tmetric.TimeEntry
+	status           transferStatus
+	err              error
+}
+
+// describeUnmappedWorkTypes lists every work type that could not be mapped to an activity once,
+// together with the OpenProject projects it's missing in
+func describeUnmappedWorkTypes(errs []error) []string {
+	projectsOfWorkType := map[string][]string{}
+	for _, err := range errs {
+		var unmappedWorkTypeError openproject.UnmappedWorkTypeError
+		if !errors.As(err, &unmappedWorkTypeError) {
+			continue
+		}
+		project := unmappedWorkTypeError.Project
+		if project == "" {
+			project = fmt.Sprintf("of work package #%v", unmappedWorkTypeError.WorkPackageId)
+		} else {
+			project = fmt.Sprintf("'%v'", project)
+		}
+		if unmappedWorkTypeError.MappedActivity != "" {
+			project += fmt.Sprintf(" (mapped to '%v')", unmappedWorkTypeError.MappedActivity)
+		}
+		if !slices.Contains(projectsOfWorkType[unmappedWorkTypeError.WorkType], project) {
+			projectsOfWorkType[unmappedWorkTypeError.WorkType] = append(
+				projectsOfWorkType[unmappedWorkTypeError.WorkType], project,
+			)
+		}
+	}
+	var descriptions []string
+	for workType, projects := range projectsOfWorkType {
+		descriptions = append(
+			descriptions, fmt.Sprintf("'%v' in the projects %v", workType, strings.Join(projects, ", ")),
+		)
+	}
+	sort.Strings(descriptions)
+	return descriptions
+}
+
+// printUnmappedWorkTypes reports the work types that could not be mapped to an activity
+func printUnmappedWorkTypes(errs []error) {
+	descriptions := describeUnmappedWorkTypes(errs)
+	if len(descriptions) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(
+		os.Stderr,
+		"these work types could not be mapped to an activity in OpenProject:\n- %v\n"+
+			"map them in the 'activities' section of the config file or set a default activity\n",
+		strings.Join(descriptions, "\n- "),
+	)
+}
+
+// printTransferSummary prints the number of transferred, skipped and failed entries
+// and the details of all entries that were not simply transferred
+func printTransferSummary(results []transferResult) {
+	counts := map[transferStatus]int{}
+	outputTable := table.NewWriter()
+	outputTable.SetOutputMirror(os.Stdout)
+	outputTable.AppendHeader(table.Row{"status", "start", "tmetric project", "note", "details"})
+	widthContentColumns := int((getTerminalWidth() - widthOfFixedColumns) / 2)
+	outputTable.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 3, WidthMax: widthContentColumns / 2},
+		{Number: 4, WidthMax: widthContentColumns / 2},
+		{Number: 5, WidthMax: widthContentColumns},
+	})
+	for _, result := range results {
+		counts[result.status]++
+		details := ""
+		switch result.status {
+		case transferCreated:
+			continue
+		case transferSkipped:
+			details = "already exists in OpenProject, only tagged in tmetric"
+		case transferFailed:
+			details = strings.TrimSpace(result.err.Error())
+		}
+		outputTable.AppendRow(table.Row{
+			result.status,
+			result.tmetricTimeEntry.StartTime,
+			result.tmetricTimeEntry.Project.Name,
+			result.tmetricTimeEntry.Note,
+			details,
+		})
+	}
+	outputTable.AppendFooter(table.Row{
+		fmt.Sprintf(
+			"%v: %v, %v: %v, %v: %v",
+			transferCreated, counts[transferCreated],
+			transferSkipped, counts[transferSkipped],
+			transferFailed, counts[transferFailed],
+		),
+	})
+	outputTable.Render()
+}
+
+// copyRun holds everything that is shared by the transfers of one run of the copy command
+type copyRun struct {
+	id              string
+	tmetricUser     tmetric.User
+	existingEntries *existingOpenProjectEntries
+	activities      *openproject.ActivityCache
+	transfers       *state.Store
+	config          *config.Config
+}
+
+func newCopyRun(
+	tmetricUser tmetric.User, activities *openproject.ActivityCache, transfers *state.Store, config *config.Config,
+) *copyRun {
+	return &copyRun{
+		id:              time.Now().UTC().Format("20060102T150405Z"),
+		tmetricUser:     tmetricUser,
+		existingEntries: newExistingOpenProjectEntries(),
+		activities:      activities,
+		transfers:       transfers,
+		config:          config,
+	}
+}
+
+// transferEntryToOpenProject creates the entry in OpenProject, if it does not exist there yet, and tags it in tmetric
+func (run *copyRun) transferEntryToOpenProject(tmetricTimeEntry tmetric.TimeEntry) (transferStatus, error) {
+	plan, err := planTransfer(tmetricTimeEntry, run.activities, run.config)
+	if err != nil {
+		return transferFailed, err
+	}
+	openProjectTimeEntry := plan.openProjectTimeEntry
+
+	linkedEntry, runId, alreadyInOpenProject, err := run.findEntryInOpenProject(tmetricTimeEntry, openProjectTimeEntry)
 	if err != nil {
-		return fmt.Errorf(
-			"could not save time entry '%v' for work package '%v' spend on '%v' in OpenProject\n"+
+		return transferFailed, fmt.Errorf(
+			"could not check for existing time entries in OpenProject\n"+
 				"Error: %v\n",
-			openProjectTimeEntry.Comment.Raw,
-			filepath.Base(openProjectTimeEntry.Links.WorkPackage.Href),
-			openProjectTimeEntry.SpentOn,
 			err,
 		)
 	}
+	if !alreadyInOpenProject {
+		runId = run.id
+		linkedEntry, err = openProjectTimeEntry.Save(*run.config)
+		if err != nil {
+			return transferFailed, fmt.Errorf(
+				"could not save time entry '%v' for work package '%v' spend on '%v' in OpenProject\n"+
+					"Error: %v\n",
+				openProjectTimeEntry.Comment.Raw,
+				filepath.Base(openProjectTimeEntry.Links.WorkPackage.Href),
+				openProjectTimeEntry.SpentOn,
+				err,
+			)
+		}
+	}
 
-	tmetricTimeEntry.TagAsTransferredToOpenProject(*config)
-	tmetricUser = tmetric.NewUser()
-	err = tmetricTimeEntry.Update(*config, tmetricUser)
+	// the transfer is recorded as pending before tagging, so that if tagging fails
+	// the next run only tags the entry instead of creating it again in OpenProject
+	workPackageId, _ := tmetricTimeEntry.GetIssueIdAsInt()
+	transfer := state.Transfer{
+		RunId:                runId,
+		TmetricEntryId:       tmetricTimeEntry.Id,
+		TmetricStartTime:     tmetricTimeEntry.StartTime,
+		TmetricNote:          tmetricTimeEntry.Note,
+		WorkPackageId:        workPackageId,
+		OpenProjectEntryId:   linkedEntry.Id,
+		OpenProjectEntryHref: linkedEntry.SelfHref(),
+		SpentOn:              openProjectTimeEntry.SpentOn,
+		TransferredAt:        time.Now().UTC().Format(time.RFC3339),
+		TagPending:           true,
+	}
+	err = run.transfers.Record(transfer)
 	if err != nil {
-		return fmt.Errorf(
+		return transferFailed, fmt.Errorf(
+			"time entry exists in OpenProject with id '%v', but the link to tmetric could not be recorded\n"+
+				"Error: %v\n",
+			linkedEntry.Id,
+			err,
+		)
+	}
+
+	err = run.tagAsTransferred(&tmetricTimeEntry)
+	if err != nil {
+		return transferFailed, fmt.Errorf(
 			"could not tag tmetric entry as being transferred to openproject\n"+
+				"The entry exists in OpenProject with id '%v' and is recorded as pending, "+
+				"the next copy will only tag it in tmetric\n"+
 				"Error: %v\n",
+			linkedEntry.Id,
 			err,
 		)
 	}
+	// tagging gave the tmetric entry a new id
+	transfer.TmetricEntryId = tmetricTimeEntry.Id
+	transfer.TagPending = false
+	err = run.transfers.Record(transfer)
+	if err != nil {
+		return transferFailed, fmt.Errorf(
+			"time entry was transferred, but could not be marked as done in the state file\n"+
+				"Error: %v\n",
+			err,
+		)
+	}
+	if alreadyInOpenProject {
+		return transferSkipped, nil
+	}
+	return transferCreated, nil
+}
+
+// transferEntries transfers the entries one after the other and shows the progress with a spinner.
+// Unless keepGoing is set, it stops at the first entry that fails
+func (run *copyRun) transferEntries(tmetricTimeEntries []tmetric.TimeEntry) []transferResult {
+	var results []transferResult
+	for _, tmetricTimeEntry := range tmetricTimeEntries {
+		spinner := newSpinner()
+		spinner.Prefix = fmt.Sprintf(
+			"Transferring data to OpenProject. Project: '%v', Note: '%v', Start: '%v' ",
+			tmetricTimeEntry.Project.Name, tmetricTimeEntry.Note, tmetricTimeEntry.StartTime,
+		)
+		spinner.Start()
+		status, err := run.transferEntryToOpenProject(tmetricTimeEntry)
+		switch status {
+		case transferCreated:
+			spinner.FinalMSG = "✔️\n"
+		case transferSkipped:
+			spinner.FinalMSG = "(already exists in OpenProject, only tagged it in tmetric) ✔️\n"
+		default:
+			spinner.FinalMSG = "❌\n"
+		}
+		spinner.Stop()
+		results = append(results, transferResult{tmetricTimeEntry: tmetricTimeEntry, status: status, err: err})
+		if err != nil && !keepGoing {
+			break
+		}
+	}
+	return results
+}
+
+// transferEntriesInParallel transfers the entries with a bounded number of workers. The result of every entry
+// is printed in the order of the entries, as soon as all entries before it are done.
+// Unless keepGoing is set, no new entries are started after an entry failed
+func (run *copyRun) transferEntriesInParallel(tmetricTimeEntries []tmetric.TimeEntry, workers int) []transferResult {
+	results := make([]transferResult, len(tmetricTimeEntries))
+	jobs := make(chan int)
+	done := make(chan int)
+	var someTransfersFailed atomic.Bool
+
+	// every transfer makes a few requests to both APIs, so the start of transfers is spaced out
+	// to not exceed the rate limits no matter how many workers there are
+	limiter := time.NewTicker(time.Second / maxTransfersPerSecond)
+	defer limiter.Stop()
+
+	var workersRunning sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		workersRunning.Add(1)
+		go func() {
+			defer workersRunning.Done()
+			for i := range jobs {
+				results[i].tmetricTimeEntry = tmetricTimeEntries[i]
+				if keepGoing || !someTransfersFailed.Load() {
+					<-limiter.C
+					// another transfer might have failed while waiting for the limiter
+					if keepGoing || !someTransfersFailed.Load() {
+						results[i].status, results[i].err = run.transferEntryToOpenProject(tmetricTimeEntries[i])
+					}
+					if results[i].err != nil {
+						someTransfersFailed.Store(true)
+					}
+				}
+				done <- i
+			}
+		}()
+	}
+	go func() {
+		for i := range tmetricTimeEntries {
+			jobs <- i
+		}
+		close(jobs)
+		workersRunning.Wait()
+		close(done)
+	}()
+
+	finished := make([]bool, len(tmetricTimeEntries))
+	next := 0
+	for i := range done {
+		finished[i] = true
+		for next < len(tmetricTimeEntries) && finished[next] {
+			printTransferResult(next+1, len(tmetricTimeEntries), results[next])
+			next++
+		}
+	}
+
+	// entries that were not started because of an earlier failure have no status
+	var attemptedResults []transferResult
+	for _, result := range results {
+		if result.status != "" {
+			attemptedResults = append(attemptedResults, result)
+		}
+	}
+	return attemptedResults
+}
+
+func printTransferResult(position int, total int, result transferResult) {
+	entry := result.tmetricTimeEntry
+	switch result.status {
+	case "":
+		return
+	case transferCreated:
+		fmt.Printf(
+			"[%v/%v] ✔️ Project: '%v', Note: '%v', Start: '%v'\n",
+			position, total, entry.Project.Name, entry.Note, entry.StartTime,
+		)
+	case transferSkipped:
+		fmt.Printf(
+			"[%v/%v] ✔️ Project: '%v', Note: '%v', Start: '%v' (already exists in OpenProject, only tagged it in tmetric)\n",
+			position, total, entry.Project.Name, entry.Note, entry.StartTime,
+		)
+	case transferFailed:
+		fmt.Printf(
+			"[%v/%v] ❌ Project: '%v', Note: '%v', Start: '%v'\n%v",
+			position, total, entry.Project.Name, entry.Note, entry.StartTime, result.err,
+		)
+	}
+}
+
+// findTransferOfEntry returns the recorded transfer of the tmetric entry. tmetric gives an edited entry a new id, so
+// it's found by its start time as well, unless one of the fetched entries still has the recorded id. If both were
+// changed, the transfer is found by the note and the work package, but only if exactly one transfer with them lost
+// its entry, i.e. none of the fetched entries has its id or start time. Without fetched entries that is skipped
+func findTransferOfEntry(
+	transfers *state.Store, tmetricTimeEntry tmetric.TimeEntry, tmetricTimeEntries []tmetric.TimeEntry,
+) (state.Transfer, bool) {
+	transfer, found := transfers.FindByTmetricEntry(tmetricTimeEntry.Id, tmetricTimeEntry.StartTime)
+	if found && (transfer.TmetricEntryId == tmetricTimeEntry.Id ||
+		!slices.ContainsFunc(tmetricTimeEntries, func(entry tmetric.TimeEntry) bool {
+			return entry.Id == transfer.TmetricEntryId
+		})) {
+		return transfer, true
+	}
+	if len(tmetricTimeEntries) == 0 {
+		return state.Transfer{}, false
+	}
+	workPackageId, err := tmetricTimeEntry.GetIssueIdAsInt()
+	if err != nil {
+		return state.Transfer{}, false
+	}
+	var transfersWithoutEntry []state.Transfer
+	for _, transfer := range transfers.TransfersOfSource(tmetricTimeEntry.Note, workPackageId) {
+		if !slices.ContainsFunc(tmetricTimeEntries, func(entry tmetric.TimeEntry) bool {
+			return transferBelongsToEntry(transfer, entry)
+		}) {
+			transfersWithoutEntry = append(transfersWithoutEntry, transfer)
+		}
+	}
+	if len(transfersWithoutEntry) != 1 {
+		return state.Transfer{}, false
+	}
+	return transfersWithoutEntry[0], true
+}
+
+// transferBelongsToEntry tells if the transfer was recorded for the tmetric entry
+func transferBelongsToEntry(transfer state.Transfer, tmetricTimeEntry tmetric.TimeEntry) bool {
+	// tmetric assigns a new id to an updated entry, so the start time identifies it as well
+	return transfer.TmetricEntryId == tmetricTimeEntry.Id || transfer.TmetricStartTime == tmetricTimeEntry.StartTime
+}
+
+// findEntryOfTransfer is the reverse of findTransferOfEntry, it returns the tmetric entry the transfer was recorded
+// for. sureMatch is false if the entry neither has the recorded id nor the recorded start time, but it's the only
+// entry with the recorded note and work package that does not belong to another transfer
+func findEntryOfTransfer(
+	transfer state.Transfer, tmetricTimeEntries []tmetric.TimeEntry, transfers *state.Store,
+) (entry tmetric.TimeEntry, sureMatch bool, found bool) {
+	for _, tmetricTimeEntry := range tmetricTimeEntries {
+		if tmetricTimeEntry.Id == transfer.TmetricEntryId {
+			return tmetricTimeEntry, true, true
+		}
+	}
+	for _, tmetricTimeEntry := range tmetricTimeEntries {
+		if tmetricTimeEntry.StartTime != transfer.TmetricStartTime {
+			continue
+		}
+		// the entry starts at the same time, but is the source of another transfer
+		otherTransfer, recorded := transfers.FindByTmetricEntry(tmetricTimeEntry.Id, "")
+		if recorded && otherTransfer.OpenProjectEntryId != transfer.OpenProjectEntryId {
+			continue
+		}
+		return tmetricTimeEntry, true, true
+	}
+	if transfer.WorkPackageId == 0 {
+		return tmetric.TimeEntry{}, false, false
+	}
+	var entriesWithoutTransfer []tmetric.TimeEntry
+	for _, tmetricTimeEntry := range tmetricTimeEntries {
+		workPackageId, err := tmetricTimeEntry.GetIssueIdAsInt()
+		if err != nil || workPackageId != transfer.WorkPackageId || tmetricTimeEntry.Note != transfer.TmetricNote {
+			continue
+		}
+		otherTransfer, recorded := findTransferOfEntry(transfers, tmetricTimeEntry, tmetricTimeEntries)
+		if !recorded || otherTransfer.OpenProjectEntryId == transfer.OpenProjectEntryId {
+			entriesWithoutTransfer = append(entriesWithoutTransfer, tmetricTimeEntry)
+		}
+	}
+	if len(entriesWithoutTransfer) != 1 {
+		return tmetric.TimeEntry{}, false, false
+	}
+	return entriesWithoutTransfer[0], false, true
+}
+
+// findEntryInOpenProject returns the entry in OpenProject the tmetric entry was already transferred to, if there is any,
+// together with the id of the run that created it
+func (run *copyRun) findEntryInOpenProject(
+	tmetricTimeEntry tmetric.TimeEntry, openProjectTimeEntry openproject.TimeEntry,
+) (openproject.TimeEntry, string, bool, error) {
+	recordedTransfer, recorded := findTransferOfEntry(run.transfers, tmetricTimeEntry, nil)
+
+	// a previous run created the entry in OpenProject, but could not tag it in tmetric
+	if recorded && recordedTransfer.TagPending {
+		pendingEntry, err := openproject.GetTimeEntry(*run.config, recordedTransfer.OpenProjectEntryId)
+		if err == nil {
+			return pendingEntry, recordedTransfer.RunId, true, nil
+		}
+	}
+
+	// the entry might have been transferred before, but the tag got lost in tmetric
+	linkedEntry, found, err := run.existingEntries.claimMatching(
+		openProjectTimeEntry, tmetricTimeEntry, run.transfers, run.config,
+	)
+	if err != nil || !found {
+		return openproject.TimeEntry{}, "", false, err
+	}
+	// this run did not create the entry, so undoing this run must not delete it
+	runId := ""
+	if recorded && recordedTransfer.OpenProjectEntryId == linkedEntry.Id {
+		runId = recordedTransfer.RunId
+	}
+	return linkedEntry, runId, true, nil
+}
+
+// tagAsTransferred tags the tmetric entry as being transferred to OpenProject.
+// At this point the entry exists in OpenProject already,
+// failed attempts are retried by the HTTP client as often as the 'http.retries' setting allows
+func (run *copyRun) tagAsTransferred(tmetricTimeEntry *tmetric.TimeEntry) error {
+	tmetricTimeEntry.TagAsTransferredToOpenProject(*run.config)
+	return tmetricTimeEntry.Update(*run.config, run.tmetricUser)
+}
+
+// showTransferPlan resolves every entry and prints a table of the time entries that would be created in OpenProject
+func (run *copyRun) showTransferPlan(tmetricTimeEntries []tmetric.TimeEntry) error {
+	spinner := newSpinner()
+	spinner.Prefix = "Resolving work packages and activities... "
 	spinner.FinalMSG = "✔️\n"
+	spinner.Start()
+	var transfers []plannedTransfer
+	var actions []string
+	var planErrors []error
+	for _, tmetricTimeEntry := range tmetricTimeEntries {
+		transfer, err := planTransfer(tmetricTimeEntry, run.activities, run.config)
+		if err != nil {
+			planErrors = append(planErrors, err)
+			continue
+		}
+		_, _, alreadyInOpenProject, err := run.findEntryInOpenProject(tmetricTimeEntry, transfer.openProjectTimeEntry)
+		if err != nil {
+			planErrors = append(planErrors, err)
+			continue
+		}
+		transfers = append(transfers, transfer)
+		if alreadyInOpenProject {
+			actions = append(actions, "tag only\n(exists)")
+		} else {
+			actions = append(actions, "create")
+		}
+	}
+	if len(planErrors) > 0 {
+		spinner.FinalMSG = "❌\n"
+	}
+	spinner.Stop()
+
+	outputTable := table.NewWriter()
+	outputTable.SetOutputMirror(os.Stdout)
+	outputTable.AppendHeader(
+		table.Row{"spent on", "tmetric project", "comment", "WP", "activity", "duration", "hours", "action"},
+	)
+	widthContentColumns := int((getTerminalWidth() - widthOfFixedColumns) / 2)
+	outputTable.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 2, WidthMax: widthContentColumns},
+		{Number: 3, WidthMax: widthContentColumns},
+	})
+	for i, transfer := range transfers {
+		humanReadableDuration, _ := transfer.tmetricTimeEntry.GetHumanReadableDuration()
+		outputTable.AppendRow(table.Row{
+			transfer.openProjectTimeEntry.SpentOn,
+			transfer.tmetricTimeEntry.Project.Name,
+			transfer.openProjectTimeEntry.Comment.Raw,
+			"#" + path.Base(transfer.openProjectTimeEntry.Links.WorkPackage.Href),
+			transfer.activity.Name,
+			humanReadableDuration,
+			transfer.openProjectTimeEntry.Hours,
+			actions[i],
+		})
+	}
+	outputTable.AppendFooter(table.Row{"", "", "", "", "", "entries", len(transfers), ""})
+	outputTable.Render()
+	fmt.Println("dry run: nothing was written to OpenProject or tmetric")
+
+	if len(planErrors) > 0 {
+		printUnmappedWorkTypes(planErrors)
+		return fmt.Errorf("%v time entries could not be resolved:\n%v", len(planErrors), errors.Join(planErrors...))
+	}
+	return nil
+}
+
+// updateTransferredEntry changes the OpenProject entry that was created from the tmetric entry,
+// so that it matches the tmetric entry again. It returns false if nothing needed to be changed
+func updateTransferredEntry(
+	tmetricTimeEntry tmetric.TimeEntry,
+	transfer state.Transfer,
+	transfers *state.Store,
+	activities *openproject.ActivityCache,
+	config *config.Config,
+) (bool, error) {
+	plannedTransfer, err := planTransfer(tmetricTimeEntry, activities, config)
+	if err != nil {
+		return false, err
+	}
+	openProjectTimeEntry, err := openproject.GetTimeEntry(*config, transfer.OpenProjectEntryId)
+	if err != nil {
+		return false, err
+	}
+	if openProjectTimeEntry.Matches(plannedTransfer.openProjectTimeEntry) {
+		return false, nil
+	}
+	if dryRun {
+		return true, nil
+	}
+	err = plannedTransfer.openProjectTimeEntry.Update(*config, transfer.OpenProjectEntryId)
+	if err != nil {
+		return false, err
+	}
+
+	// the tmetric entry might have been found by its start time or its note and the day might have changed,
+	// so keep the record up to date for the next run
+	workPackageId, _ := tmetricTimeEntry.GetIssueIdAsInt()
+	transfer.TmetricEntryId = tmetricTimeEntry.Id
+	transfer.TmetricStartTime = tmetricTimeEntry.StartTime
+	transfer.TmetricNote = tmetricTimeEntry.Note
+	transfer.WorkPackageId = workPackageId
+	transfer.SpentOn = plannedTransfer.openProjectTimeEntry.SpentOn
+	return true, transfers.Record(transfer)
+}
+
+// updateTransferredEntries propagates changes of already transferred tmetric entries to OpenProject
+func updateTransferredEntries(
+	tmetricTimeEntries []tmetric.TimeEntry,
+	transfers *state.Store,
+	activities *openproject.ActivityCache,
+	config *config.Config,
+) error {
+	updated, unchanged := 0, 0
+	var entriesWithoutRecord []tmetric.TimeEntry
+	for _, tmetricTimeEntry := range tmetricTimeEntries {
+		transfer, found := findTransferOfEntry(transfers, tmetricTimeEntry, tmetricTimeEntries)
+		if !found {
+			entriesWithoutRecord = append(entriesWithoutRecord, tmetricTimeEntry)
+			continue
+		}
+		spinner := newSpinner()
+		spinner.Prefix = fmt.Sprintf(
+			"Checking OpenProject entry %v. Project: '%v', Note: '%v', Start: '%v' ",
+			transfer.OpenProjectEntryId, tmetricTimeEntry.Project.Name, tmetricTimeEntry.Note, tmetricTimeEntry.StartTime,
+		)
+		spinner.FinalMSG = "❌\n"
+		spinner.Start()
+		changed, err := updateTransferredEntry(tmetricTimeEntry, transfer, transfers, activities, config)
+		if err != nil {
+			spinner.Stop()
+			return fmt.Errorf(
+				"could not update OpenProject entry '%v' of time entry '%v' in project '%v'\n"+
+					"Error: %v\n",
+				transfer.OpenProjectEntryId, tmetricTimeEntry.Note, tmetricTimeEntry.Project.Name, err,
+			)
+		}
+		switch {
+		case changed && dryRun:
+			spinner.FinalMSG = "would be updated\n"
+			updated++
+		case changed:
+			spinner.FinalMSG = "updated ✔️\n"
+			updated++
+		default:
+			// nothing to report for entries that are still in sync
+			spinner.FinalMSG = ""
+			unchanged++
+		}
+		spinner.Stop()
+	}
+	for _, tmetricTimeEntry := range entriesWithoutRecord {
+		fmt.Printf(
+			"No OpenProject entry is recorded for the time entry '%v' in project '%v' started at '%v', skipping\n",
+			tmetricTimeEntry.Note, tmetricTimeEntry.Project.Name, tmetricTimeEntry.StartTime,
+		)
+	}
+	fmt.Printf(
+		"transferred entries: %v updated, %v unchanged, %v without record\n",
+		updated, unchanged, len(entriesWithoutRecord),
+	)
+	return nil
+}
+
+// copyEntries transfers the time entries of the time period from tmetric to OpenProject
+func copyEntries(config *config.Config) error {
+	tmetricUser, err := tmetric.NewUser(config)
+	if err != nil {
+		return err
+	}
+
+	timeEntries, err := checkTmetricEntries(tmetricUser, config)
+	if err != nil {
+		return err
+	}
+	filteredEntries := tmetric.GetEntriesNotTransferredToOpenProject(
+		timeEntries, config.TmetricTagTransferredToOpenProject,
+	)
+	transfers, err := state.Load(config.StateFile)
+	if err != nil {
+		return err
+	}
+	activities := newActivityCache(timeEntries, config)
+	run := newCopyRun(tmetricUser, activities, transfers, config)
+	someTransfersFailed := false
+	if dryRun {
+		err = run.showTransferPlan(filteredEntries)
+		if err != nil {
+			return err
+		}
+	} else {
+		var results []transferResult
+		if parallelTransfers > 1 {
+			results = run.transferEntriesInParallel(filteredEntries, parallelTransfers)
+		} else {
+			results = run.transferEntries(filteredEntries)
+		}
+		for _, result := range results {
+			if result.err != nil && !keepGoing {
+				fmt.Printf("to undo this run use: undo --run %v\n", run.id)
+				// in parallel mode the error was printed together with the result already
+				if parallelTransfers > 1 {
+					return fmt.Errorf("the transfer was stopped because of the error above")
+				}
+				return result.err
+			}
+		}
+		if keepGoing {
+			printTransferSummary(results)
+		}
+		if len(filteredEntries) > 0 {
+			fmt.Printf("to undo this run use: undo --run %v\n", run.id)
+		}
+		var transferErrors []error
+		for _, result := range results {
+			if result.status == transferFailed {
+				someTransfersFailed = true
+				transferErrors = append(transferErrors, result.err)
+			}
+		}
+		printUnmappedWorkTypes(transferErrors)
+	}
+
+	if updateTransferred {
+		transferredEntries := tmetric.GetEntriesTransferredToOpenProject(
+			timeEntries, config.TmetricTagTransferredToOpenProject,
+		)
+		err = updateTransferredEntries(transferredEntries, transfers, activities, config)
+		if err != nil {
+			return err
+		}
+	}
+	if someTransfersFailed {
+		return fmt.Errorf("some time entries could not be transferred")
+	}
 	return nil
 }
 
@@ -142,24 +883,13 @@ var copyCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("end date is not in the format YYYY-MM-DD")
 		}
-		return nil
+		if parallelTransfers < 1 {
+			return fmt.Errorf("the number of parallel transfers has to be at least 1")
+		}
+		return checkProfileFlags()
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		config := config.NewConfig()
-		tmetricUser := tmetric.NewUser()
-
-		filteredEntries, err := checkTmetricEntries(tmetricUser, config)
-		if err != nil {
-			_, _ = fmt.Fprint(os.Stderr, err)
-			os.Exit(1)
-		}
-		for _, tmetricTimeEntry := range filteredEntries {
-			err = transferEntryToOpenProject(tmetricTimeEntry, tmetricUser, config)
-			if err != nil {
-				_, _ = fmt.Fprint(os.Stderr, err)
-				os.Exit(1)
-			}
-		}
+		runForProfiles(copyEntries)
 	},
 }
 
@@ -172,4 +902,25 @@ func init() {
 	copyCmd.Flags().StringVarP(&startDate, "start", "s", firstDayOfMonth, "start date")
 	today := time.Now().Format("2006-01-02")
 	copyCmd.Flags().StringVarP(&endDate, "end", "e", today, "end date")
+	copyCmd.Flags().BoolVar(
+		&dryRun, "dry-run", false, "show the time entries that would be created in OpenProject without writing anything",
+	)
+	copyCmd.Flags().BoolVar(
+		&keepGoing,
+		"keep-going",
+		false,
+		"continue with the remaining entries if an entry fails and print a summary at the end",
+	)
+	copyCmd.Flags().IntVar(
+		&parallelTransfers, "parallel", 1, "number of entries that are transferred at the same time",
+	)
+	copyCmd.Flags().BoolVar(
+		&updateTransferred,
+		"update",
+		false,
+		"also update the OpenProject entries of already transferred time entries that were changed in tmetric",
+	)
+	copyCmd.Flags().BoolVar(
+		&allProfiles, "all-profiles", false, "copy the time entries of every profile in the config file one after the other",
+	)
 }
@@ -0,0 +1,537 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/state"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBackends acts as OpenProject and tmetric for the tests of the copy command
+type fakeBackends struct {
+	mutex sync.Mutex
+	// requests holds the method and the path of every request
+	requests []string
+	// failingTagUpdates is the number of updates in tmetric that fail before they work, -1 lets all of them fail
+	failingTagUpdates int
+	// failingNote is the comment of the entries that cannot be created in OpenProject
+	failingNote string
+	// readOnly lets every request fail that could change data
+	readOnly bool
+	// slowNote is the comment of the entries that take a second to be created in OpenProject,
+	// that is longer than the rate limit of the transfers needs to start a few others
+	slowNote       string
+	createdEntries int
+	// tmetricEntries are the entries tmetric returns for any time period
+	tmetricEntries []tmetric.TimeEntry
+	// updatedEntries are the tmetric entries the way they were sent to tmetric
+	updatedEntries []tmetric.TimeEntry
+	// openProjectEntries are the entries OpenProject returns by their id, other ids return an empty entry
+	openProjectEntries map[int]openproject.TimeEntry
+	// patchedEntries are the changes of the OpenProject entries the way they were sent to OpenProject
+	patchedEntries []openproject.TimeEntry
+}
+
+func (f *fakeBackends) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if f.slowNote != "" && r.Method == http.MethodPost && strings.Contains(string(body), `"`+f.slowNote+`"`) {
+		time.Sleep(time.Second)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	// the form only validates an entry, it does not create one
+	if f.readOnly && r.Method != http.MethodGet && r.URL.Path != "/api/v3/time_entries/form" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v3/user":
+		w.Write([]byte(`{"id":1,"name":"Peter Pan","activeAccountId":2}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/v3/accounts/2/timeentries":
+		_ = json.NewEncoder(w).Encode(f.tmetricEntries)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v3/work_packages":
+		w.Write([]byte(`{"_embedded":{"elements":[]}}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v3/time_entries/form":
+		w.Write([]byte(`{"_embedded":{"schema":{"activity":{"_embedded":{"allowedValues":[
+			{"id":3,"name":"Development"}
+		]}}}}}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v3/time_entries":
+		w.Write([]byte(`{"_embedded":{"elements":[]}}`))
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v3/time_entries/"):
+		id := path.Base(r.URL.Path)
+		if entryId, err := strconv.Atoi(id); err == nil {
+			if timeEntry, found := f.openProjectEntries[entryId]; found {
+				_ = json.NewEncoder(w).Encode(timeEntry)
+				return
+			}
+		}
+		_, _ = fmt.Fprintf(w, `{"id":%v,"_links":{"self":{"href":"/api/v3/time_entries/%v"}}}`, id, id)
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/api/v3/time_entries/"):
+		var timeEntry openproject.TimeEntry
+		_ = json.Unmarshal(body, &timeEntry)
+		f.patchedEntries = append(f.patchedEntries, timeEntry)
+		w.Write(body)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v3/time_entries/":
+		var timeEntry openproject.TimeEntry
+		_ = json.Unmarshal(body, &timeEntry)
+		if timeEntry.Comment.Raw == f.failingNote {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		f.createdEntries++
+		id := 100 + f.createdEntries
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"id":%v,"_links":{"self":{"href":"/api/v3/time_entries/%v"}}}`, id, id)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v3/accounts/"):
+		if f.failingTagUpdates != 0 {
+			if f.failingTagUpdates > 0 {
+				f.failingTagUpdates--
+			}
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var timeEntry tmetric.TimeEntry
+		_ = json.Unmarshal(body, &timeEntry)
+		f.updatedEntries = append(f.updatedEntries, timeEntry)
+		// like tmetric, the updated entry gets a new id
+		timeEntry.Id += 1000
+		_ = json.NewEncoder(w).Encode(timeEntry)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newTestCopyRun returns a copy run that talks to the fake backends and records the transfers in a temporary file
+func newTestCopyRun(t *testing.T, backends *fakeBackends) *copyRun {
+	mockServer := httptest.NewServer(backends)
+	t.Cleanup(mockServer.Close)
+	config := &config.Config{
+		OpenProjectUrl:                     mockServer.URL,
+		OpenProjectToken:                   "dummyToken",
+		TmetricToken:                       "dummyToken",
+		TmetricAPIV3BaseUrl:                mockServer.URL + "/v3/",
+		TmetricTagTransferredToOpenProject: "transferred-to-openproject",
+		TmetricExternalTaskLink:            "https://op.example.com/",
+		ClientIdInTmetric:                  5,
+		StateFile:                          filepath.Join(t.TempDir(), "state.json"),
+	}
+	transfers, err := state.Load(config.StateFile)
+	assert.NoError(t, err)
+	return newCopyRun(tmetric.User{ActiveAccountId: 2}, openproject.NewActivityCache(), transfers, config)
+}
+
+// newTestTmetricEntry returns an entry of one hour on the given day that is linked to work package #12
+func newTestTmetricEntry(id int, note string, day string) tmetric.TimeEntry {
+	return tmetric.TimeEntry{
+		Id:        id,
+		Note:      note,
+		StartTime: day + "T09:00:00",
+		EndTime:   day + "T10:00:00",
+		Task: tmetric.Task{
+			Id:           7,
+			ExternalLink: tmetric.ExternalLink{IssueId: "#12", Link: "https://op.example.com/work_packages/12"},
+		},
+		Project: tmetric.Project{Id: 3, Name: "Website", Client: tmetric.Client{Id: 5}},
+		Tags:    []tmetric.Tag{{Name: "Development", IsWorkType: true}},
+	}
+}
+
+// TestCopyEntries_keepGoing runs the copy in a separate process, so that its exit status can be checked
+func TestCopyEntries_keepGoing(t *testing.T) {
+	if fakeUrl := os.Getenv("COPY_TEST_FAKE_URL"); fakeUrl != "" {
+		viper.Set("openproject.url", fakeUrl)
+		viper.Set("openproject.token", "dummyToken")
+		viper.Set("tmetric.token", "dummyToken")
+		viper.Set("tmetric.clientId", 5)
+		viper.Set("tmetric.dummyProjectId", 9)
+		viper.Set("tmetric.apiBaseUrl", fakeUrl+"/")
+		viper.Set("tmetric.apiV3BaseUrl", fakeUrl+"/v3/")
+		viper.Set("tmetric.externalTaskLink", "https://op.example.com/")
+		viper.Set("state.file", os.Getenv("COPY_TEST_STATE_FILE"))
+		keepGoing = true
+		startDate, endDate = "2024-05-01", "2024-05-31"
+		runForProfiles(copyEntries)
+		return
+	}
+
+	backends := &fakeBackends{
+		failingNote: "broken",
+		tmetricEntries: []tmetric.TimeEntry{
+			newTestTmetricEntry(1, "coding", "2024-05-10"),
+			newTestTmetricEntry(2, "broken", "2024-05-11"),
+			newTestTmetricEntry(3, "testing", "2024-05-12"),
+		},
+	}
+	mockServer := httptest.NewServer(backends)
+	defer mockServer.Close()
+	copyProcess := exec.Command(os.Args[0], "-test.run=^TestCopyEntries_keepGoing$")
+	copyProcess.Env = append(
+		os.Environ(),
+		"COPY_TEST_FAKE_URL="+mockServer.URL,
+		"COPY_TEST_STATE_FILE="+filepath.Join(t.TempDir(), "state.json"),
+	)
+	output, err := copyProcess.Output()
+
+	var exitError *exec.ExitError
+	if assert.ErrorAs(t, err, &exitError, "copy has to fail if some entries failed") {
+		assert.Equal(t, 1, exitError.ExitCode())
+		assert.Contains(t, string(exitError.Stderr), "some time entries could not be transferred")
+	}
+	assert.Contains(t, string(output), "TRANSFERRED: 2, SKIPPED: 0, FAILED: 1")
+	assert.Contains(t, string(output), "broken")
+	assert.Equal(t, 2, backends.createdEntries)
+}
+
+func TestCopyRun_transferEntryToOpenProject(t *testing.T) {
+	backends := &fakeBackends{}
+	run := newTestCopyRun(t, backends)
+
+	status, err := run.transferEntryToOpenProject(newTestTmetricEntry(1, "coding", "2024-05-10"))
+	assert.NoError(t, err)
+	assert.Equal(t, transferCreated, status)
+	assert.Len(t, backends.updatedEntries, 1)
+	assert.Contains(t, backends.updatedEntries[0].Tags, tmetric.Tag{Name: "transferred-to-openproject"})
+	// the transfer is recorded with the id tmetric gave the entry when it was tagged
+	assert.Equal(t, []state.Transfer{{
+		RunId:                run.id,
+		TmetricEntryId:       1001,
+		TmetricStartTime:     "2024-05-10T09:00:00",
+		TmetricNote:          "coding",
+		WorkPackageId:        12,
+		OpenProjectEntryId:   101,
+		OpenProjectEntryHref: "/api/v3/time_entries/101",
+		SpentOn:              "2024-05-10",
+		TransferredAt:        run.transfers.Transfers[0].TransferredAt,
+	}}, run.transfers.Transfers)
+	// so it's still found after the start time was changed in tmetric
+	_, found := run.transfers.FindByTmetricEntry(1001, "2024-05-10T08:30:00")
+	assert.True(t, found)
+}
+
+func TestFindTransferOfEntry_idAndStartTimeChanged(t *testing.T) {
+	backends := &fakeBackends{}
+	run := newTestCopyRun(t, backends)
+	_, err := run.transferEntryToOpenProject(newTestTmetricEntry(1, "coding", "2024-05-10"))
+	assert.NoError(t, err)
+	// another entry that starts at the time the transferred one was moved to
+	_, err = run.transferEntryToOpenProject(newTestTmetricEntry(2, "review", "2024-05-11"))
+	assert.NoError(t, err)
+
+	// the start time was corrected in tmetric, that gave the entry a new id
+	editedEntry := backends.updatedEntries[0]
+	editedEntry.Id = 5000
+	editedEntry.StartTime = "2024-05-11T09:00:00"
+	editedEntry.EndTime = "2024-05-11T10:30:00"
+	otherEntry := backends.updatedEntries[1]
+	otherEntry.Id = 1002
+	fetchedEntries := []tmetric.TimeEntry{editedEntry, otherEntry}
+
+	// the other entry still has its recorded id, so the start time does not link the edited entry to its transfer
+	transfer, found := findTransferOfEntry(run.transfers, editedEntry, fetchedEntries)
+	assert.True(t, found)
+	assert.Equal(t, 101, transfer.OpenProjectEntryId)
+	transfer, found = findTransferOfEntry(run.transfers, otherEntry, fetchedEntries)
+	assert.True(t, found)
+	assert.Equal(t, 102, transfer.OpenProjectEntryId)
+
+	lostTransfer, _ := run.transfers.FindByOpenProjectEntry(101)
+	entry, sureMatch, found := findEntryOfTransfer(lostTransfer, fetchedEntries, run.transfers)
+	assert.True(t, found)
+	assert.False(t, sureMatch)
+	assert.Equal(t, 5000, entry.Id)
+
+	// with two transfers of the same note and work package it's unknown which one the edited entry belongs to
+	_, err = run.transferEntryToOpenProject(newTestTmetricEntry(3, "coding", "2024-05-12"))
+	assert.NoError(t, err)
+	_, found = findTransferOfEntry(run.transfers, editedEntry, fetchedEntries)
+	assert.False(t, found)
+}
+
+func TestCopyRun_showTransferPlan(t *testing.T) {
+	backends := &fakeBackends{readOnly: true}
+	run := newTestCopyRun(t, backends)
+
+	err := run.showTransferPlan([]tmetric.TimeEntry{
+		newTestTmetricEntry(1, "coding", "2024-05-10"),
+		newTestTmetricEntry(2, "testing", "2024-05-11"),
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, backends.requests)
+	for _, request := range backends.requests {
+		if request != "POST /api/v3/time_entries/form" {
+			assert.True(t, strings.HasPrefix(request, "GET "), "a dry run must not change data: %v", request)
+		}
+	}
+	assert.Empty(t, run.transfers.Transfers)
+}
+
+func TestCopyRun_tagAsTransferred(t *testing.T) {
+	t.Run("failed tagging is retried", func(t *testing.T) {
+		backends := &fakeBackends{failingTagUpdates: 1}
+		run := newTestCopyRun(t, backends)
+		run.config.HttpRetries = 1
+
+		status, err := run.transferEntryToOpenProject(newTestTmetricEntry(1, "coding", "2024-05-10"))
+		assert.NoError(t, err)
+		assert.Equal(t, transferCreated, status)
+		assert.Len(t, backends.updatedEntries, 1)
+		assert.False(t, run.transfers.Transfers[0].TagPending)
+	})
+	t.Run("the transfer stays pending if tagging fails", func(t *testing.T) {
+		backends := &fakeBackends{failingTagUpdates: -1}
+		run := newTestCopyRun(t, backends)
+		tmetricTimeEntry := newTestTmetricEntry(1, "coding", "2024-05-10")
+
+		status, err := run.transferEntryToOpenProject(tmetricTimeEntry)
+		assert.ErrorContains(t, err, "is recorded as pending")
+		assert.Equal(t, transferFailed, status)
+		transfers, err := state.Load(run.config.StateFile)
+		assert.NoError(t, err)
+		assert.Len(t, transfers.Transfers, 1)
+		assert.True(t, transfers.Transfers[0].TagPending)
+		assert.Equal(t, 101, transfers.Transfers[0].OpenProjectEntryId)
+
+		// the next run only tags the entry, it's not created a second time in OpenProject
+		backends.mutex.Lock()
+		backends.failingTagUpdates = 0
+		backends.mutex.Unlock()
+		nextRun := newCopyRun(run.tmetricUser, openproject.NewActivityCache(), transfers, run.config)
+		status, err = nextRun.transferEntryToOpenProject(tmetricTimeEntry)
+		assert.NoError(t, err)
+		assert.Equal(t, transferSkipped, status)
+		assert.Equal(t, 1, backends.createdEntries)
+		assert.Len(t, backends.updatedEntries, 1)
+		assert.Len(t, transfers.Transfers, 1)
+		assert.False(t, transfers.Transfers[0].TagPending)
+		assert.Equal(t, 101, transfers.Transfers[0].OpenProjectEntryId)
+		assert.Equal(t, run.id, transfers.Transfers[0].RunId)
+	})
+}
+
+// setKeepGoing sets the --keep-going flag for the test
+func setKeepGoing(t *testing.T, value bool) {
+	original := keepGoing
+	t.Cleanup(func() {
+		keepGoing = original
+	})
+	keepGoing = value
+}
+
+// notesOfResults returns the note and the status of every result
+func notesOfResults(results []transferResult) []string {
+	var notes []string
+	for _, result := range results {
+		notes = append(notes, fmt.Sprintf("%v: %v", result.tmetricTimeEntry.Note, result.status))
+	}
+	return notes
+}
+
+func TestCopyRun_transferEntriesInParallel(t *testing.T) {
+	t.Run("results are in the order of the entries", func(t *testing.T) {
+		setKeepGoing(t, true)
+		backends := &fakeBackends{slowNote: "slow", failingNote: "broken"}
+		run := newTestCopyRun(t, backends)
+
+		results := run.transferEntriesInParallel([]tmetric.TimeEntry{
+			newTestTmetricEntry(1, "slow", "2024-05-10"),
+			newTestTmetricEntry(2, "fast", "2024-05-10"),
+			newTestTmetricEntry(3, "broken", "2024-05-10"),
+		}, 3)
+		assert.Equal(t, []string{"slow: transferred", "fast: transferred", "broken: failed"}, notesOfResults(results))
+		// the first entry was created last in OpenProject
+		slowTransfer, _ := run.transfers.FindByTmetricEntry(1001, "")
+		assert.Equal(t, 102, slowTransfer.OpenProjectEntryId)
+	})
+	t.Run("no new entries are started after a failure", func(t *testing.T) {
+		setKeepGoing(t, false)
+		backends := &fakeBackends{failingNote: "broken"}
+		run := newTestCopyRun(t, backends)
+
+		results := run.transferEntriesInParallel([]tmetric.TimeEntry{
+			newTestTmetricEntry(1, "broken", "2024-05-10"),
+			newTestTmetricEntry(2, "second", "2024-05-11"),
+			newTestTmetricEntry(3, "third", "2024-05-12"),
+			newTestTmetricEntry(4, "fourth", "2024-05-13"),
+		}, 2)
+		// the second entry might have been started by the other worker before the first one failed
+		notes := notesOfResults(results)
+		assert.Equal(t, "broken: failed", notes[0])
+		assert.LessOrEqual(t, len(notes), 2)
+		assert.LessOrEqual(t, backends.createdEntries, 1)
+	})
+}
+
+func TestExistingOpenProjectEntries_claimMatching(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"_embedded":{"elements":[{
+			"id":10,"comment":{"raw":"standup"},"spentOn":"2024-05-10","hours":"PT1H",
+			"_links":{"workPackage":{"href":"/api/v3/work_packages/12"},"activity":{"href":"/api/v3/time_entries/activities/3"}}
+		}]}}`))
+	}))
+	defer mockServer.Close()
+	config := config.Config{OpenProjectUrl: mockServer.URL, OpenProjectToken: "dummyToken"}
+	transfers, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+
+	var openProjectTimeEntry openproject.TimeEntry
+	openProjectTimeEntry.Comment.Raw = "standup"
+	openProjectTimeEntry.SpentOn = "2024-05-10"
+	openProjectTimeEntry.Hours = "PT1H"
+	openProjectTimeEntry.Links.WorkPackage.Href = "/api/v3/work_packages/12"
+	openProjectTimeEntry.Links.Activity.Href = "/api/v3/time_entries/activities/3"
+	// two identical entries in tmetric, but only one of them exists in OpenProject
+	firstEntry := tmetric.TimeEntry{Id: 1, Note: "standup", StartTime: "2024-05-10T09:00:00"}
+	secondEntry := tmetric.TimeEntry{Id: 2, Note: "standup", StartTime: "2024-05-10T11:00:00"}
+
+	claimed, found, err := newExistingOpenProjectEntries().claimMatching(
+		openProjectTimeEntry, firstEntry, transfers, &config,
+	)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 10, claimed.Id)
+	assert.NoError(t, transfers.Record(state.Transfer{
+		TmetricEntryId: firstEntry.Id, TmetricStartTime: firstEntry.StartTime, OpenProjectEntryId: claimed.Id,
+	}))
+
+	// a later run loads the entries from OpenProject again, but the state file links the entry to the first one
+	_, found, err = newExistingOpenProjectEntries().claimMatching(
+		openProjectTimeEntry, secondEntry, transfers, &config,
+	)
+	assert.NoError(t, err)
+	assert.False(t, found, "the second entry has to be created in OpenProject")
+
+	// the first entry can still find its own entry, e.g. when only the tag in tmetric got lost
+	claimed, found, err = newExistingOpenProjectEntries().claimMatching(
+		openProjectTimeEntry, firstEntry, transfers, &config,
+	)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 10, claimed.Id)
+}
+
+// setDryRun sets the --dry-run flag for the test
+func setDryRun(t *testing.T, value bool) {
+	original := dryRun
+	t.Cleanup(func() {
+		dryRun = original
+	})
+	dryRun = value
+}
+
+// changingRequests returns the requests that could change data, the time entry form only validates an entry
+func changingRequests(backends *fakeBackends) []string {
+	var requests []string
+	for _, request := range backends.requests {
+		if !strings.HasPrefix(request, "GET ") && request != "POST /api/v3/time_entries/form" {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func TestUpdateTransferredEntries(t *testing.T) {
+	// the OpenProject entry the way it was created from the tmetric entry 1 with the id 101
+	var openProjectTimeEntry openproject.TimeEntry
+	openProjectTimeEntry.Id = 101
+	openProjectTimeEntry.Comment.Raw = "coding"
+	openProjectTimeEntry.SpentOn = "2024-05-10"
+	openProjectTimeEntry.Hours = "PT1H"
+	openProjectTimeEntry.Links.WorkPackage.Href = "/api/v3/work_packages/12"
+	openProjectTimeEntry.Links.Activity.Href = "/api/v3/time_entries/activities/3"
+	transfer := state.Transfer{
+		TmetricEntryId:     1001,
+		TmetricStartTime:   "2024-05-10T09:00:00",
+		TmetricNote:        "coding",
+		WorkPackageId:      12,
+		OpenProjectEntryId: 101,
+		SpentOn:            "2024-05-10",
+	}
+	// transferredEntry returns the transferred tmetric entry with the tag it got in the transfer
+	transferredEntry := func(id int, note string, day string) tmetric.TimeEntry {
+		entry := newTestTmetricEntry(id, note, day)
+		entry.Tags = append(entry.Tags, tmetric.Tag{Name: "transferred-to-openproject"})
+		return entry
+	}
+	// newUpdateTest returns a copy run whose state file has the transfer of the entry 101
+	newUpdateTest := func(t *testing.T) (*copyRun, *fakeBackends) {
+		backends := &fakeBackends{openProjectEntries: map[int]openproject.TimeEntry{101: openProjectTimeEntry}}
+		run := newTestCopyRun(t, backends)
+		assert.NoError(t, run.transfers.Record(transfer))
+		return run, backends
+	}
+
+	t.Run("a changed entry is updated", func(t *testing.T) {
+		setDryRun(t, false)
+		run, backends := newUpdateTest(t)
+		// the entry was moved to the next day and made longer, that gave it a new id in tmetric
+		changedEntry := transferredEntry(2001, "coding", "2024-05-11")
+		changedEntry.EndTime = "2024-05-11T10:30:00"
+
+		err := updateTransferredEntries([]tmetric.TimeEntry{changedEntry}, run.transfers, run.activities, run.config)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"PATCH /api/v3/time_entries/101"}, changingRequests(backends))
+		if assert.Len(t, backends.patchedEntries, 1) {
+			assert.Equal(t, "2024-05-11", backends.patchedEntries[0].SpentOn)
+			duration, _ := backends.patchedEntries[0].GetDuration()
+			assert.Equal(t, 90*time.Minute, duration)
+		}
+		updatedTransfer, found := run.transfers.FindByOpenProjectEntry(101)
+		assert.True(t, found)
+		assert.Equal(t, 2001, updatedTransfer.TmetricEntryId)
+		assert.Equal(t, "2024-05-11T09:00:00", updatedTransfer.TmetricStartTime)
+		assert.Equal(t, "2024-05-11", updatedTransfer.SpentOn)
+	})
+	t.Run("an unchanged entry is not updated", func(t *testing.T) {
+		setDryRun(t, false)
+		run, backends := newUpdateTest(t)
+
+		err := updateTransferredEntries(
+			[]tmetric.TimeEntry{transferredEntry(1001, "coding", "2024-05-10")}, run.transfers, run.activities, run.config,
+		)
+		assert.NoError(t, err)
+		assert.Empty(t, changingRequests(backends))
+		assert.Equal(t, []state.Transfer{transfer}, run.transfers.Transfers)
+	})
+	t.Run("an entry without record is skipped", func(t *testing.T) {
+		setDryRun(t, false)
+		run, backends := newUpdateTest(t)
+		entryWithoutRecord := newTestTmetricEntry(3001, "testing", "2024-05-12")
+		entryWithoutRecord.Tags = append(entryWithoutRecord.Tags, tmetric.Tag{Name: "transferred-to-openproject"})
+
+		err := updateTransferredEntries(
+			[]tmetric.TimeEntry{entryWithoutRecord}, run.transfers, run.activities, run.config,
+		)
+		assert.NoError(t, err)
+		assert.Empty(t, backends.requests)
+		assert.Equal(t, []state.Transfer{transfer}, run.transfers.Transfers)
+	})
+	t.Run("a dry run does not update the entry", func(t *testing.T) {
+		setDryRun(t, true)
+		run, backends := newUpdateTest(t)
+		changedEntry := transferredEntry(2001, "coding and testing", "2024-05-10")
+
+		err := updateTransferredEntries([]tmetric.TimeEntry{changedEntry}, run.transfers, run.activities, run.config)
+		assert.NoError(t, err)
+		assert.Empty(t, changingRequests(backends))
+		assert.Empty(t, backends.patchedEntries)
+		assert.Equal(t, []state.Transfer{transfer}, run.transfers.Transfers)
+	})
+}
@@ -59,6 +59,140 @@ func getTerminalWidth() int {
 	}
 }
 
+// showDiff prints a table that compares the entries in tmetric and OpenProject day by day
+func showDiff(config *config.Config) error {
+	tmetricUserMe, err := tmetric.NewUser(config)
+	if err != nil {
+		return err
+	}
+	var tmetricUser tmetric.User
+	if userNameFromCmd == "" {
+		tmetricUser = tmetricUserMe
+	} else {
+		var err error
+		tmetricUser, err = tmetric.FindUserByName(config, tmetricUserMe, userNameFromCmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	tmetricTimeEntries, err := tmetric.GetAllTimeEntries(config, tmetricUser, startDate, endDate)
+	if err != nil {
+		return err
+	}
+
+	var openProjectUser openproject.User
+	if userNameFromCmd != "" {
+		var err error
+		openProjectUser, err = openproject.FindUserByName(config, userNameFromCmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	openProjectTimeEntries, err := openproject.GetAllTimeEntries(config, openProjectUser, startDate, endDate, nil)
+	if err != nil {
+		return err
+	}
+
+	start, _ := time.Parse("2006-01-02", startDate)
+	end, _ := time.Parse("2006-01-02", endDate)
+	outputTable := table.NewWriter()
+	outputTable.SetOutputMirror(os.Stdout)
+
+	outputTable.AppendHeader(
+		table.Row{"date", "tmetric entry", "tm\ndur", "OpenProject entry", "OP\ndur", "time\ndiff"},
+	)
+	widthContentColumns := int((getTerminalWidth() - widthOfFixedColumns) / 2)
+	outputTable.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 2, WidthMax: widthContentColumns},
+		{Number: 4, WidthMax: widthContentColumns},
+	})
+
+	totalTimeDiff := 0
+	for currentDay := start; !currentDay.After(end); currentDay = currentDay.AddDate(0, 0, 1) {
+		row := tableRow{}
+		row.Date = currentDay.Format("2006-01-02")
+		sumDurationTmetric := 0
+		for _, entry := range tmetricTimeEntries {
+			entryDate, _ := time.Parse("2006-01-02", entry.StartTime[:10])
+			if entryDate.Equal(currentDay) {
+				workType, _ := entry.GetWorkType()
+				description := fmt.Sprintf("Description: %v", entry.Note)
+				project := fmt.Sprintf("- Project: %v", entry.Project.Name)
+				wpId := fmt.Sprintf("- WP ID: %v", entry.Task.ExternalLink.IssueId)
+				wp := fmt.Sprintf("- WP: %v", entry.Task.Name)
+				workType = fmt.Sprintf("- Work Type: %v", workType)
+				row.TmetricEntry += fmt.Sprintf(
+					"%v\n%v\n%v\n%v\n%v\n\n",
+					text.Snip(description, widthContentColumns, "~"),
+					text.Snip(project, widthContentColumns, "~"),
+					text.Snip(wpId, widthContentColumns, "~"),
+					text.Snip(wp, widthContentColumns, "~"),
+					text.Snip(workType, widthContentColumns, "~"),
+				)
+				duration, _ := entry.GetDuration()
+				sumDurationTmetric += int(duration.Minutes())
+				humanReadableDuration, _ := entry.GetHumanReadableDuration()
+
+				row.TmetricDuration += fmt.Sprintf("%v\n\n\n\n\n\n", humanReadableDuration)
+			}
+		}
+		sumDurationOpenProject := 0
+		for _, entry := range openProjectTimeEntries {
+			entryDate, _ := time.Parse("2006-01-02", entry.SpentOn)
+			if entryDate.Equal(currentDay) {
+				comment := fmt.Sprintf("Comment: %v", entry.Comment.Raw)
+				project := fmt.Sprintf("- Project: %v", entry.Links.Project.Title)
+				wpId := fmt.Sprintf("- WP ID: #%v", path.Base(entry.Links.WorkPackage.Href))
+				wp := fmt.Sprintf("- WP: %v", entry.Links.WorkPackage.Title)
+				activity := fmt.Sprintf("- Activity: %v", entry.Links.Activity.Title)
+				row.OpenProjectEntry += fmt.Sprintf(
+					"%v\n%v\n%v\n%v\n%v\n\n",
+					text.Snip(comment, widthContentColumns, "~"),
+					text.Snip(project, widthContentColumns, "~"),
+					text.Snip(wpId, widthContentColumns, "~"),
+					text.Snip(wp, widthContentColumns, "~"),
+					text.Snip(activity, widthContentColumns, "~"),
+				)
+				duration, _ := entry.GetDuration()
+				sumDurationOpenProject += int(duration.Minutes())
+				humanReadableDuration, _ := entry.GetHumanReadableDuration()
+				row.OpenProjectDuration += fmt.Sprintf("%v\n\n\n\n\n\n", humanReadableDuration)
+			}
+		}
+		if sumDurationTmetric > sumDurationOpenProject {
+			diff := sumDurationTmetric - sumDurationOpenProject
+			row.DiffInTime = strconv.Itoa(diff)
+			totalTimeDiff += diff
+		} else {
+			diff := sumDurationOpenProject - sumDurationTmetric
+			row.DiffInTime = strconv.Itoa(diff)
+			totalTimeDiff += diff
+		}
+
+		outputTable.AppendRow(table.Row{
+			row.Date,
+			strings.Trim(row.TmetricEntry, "\n"),
+			strings.Trim(row.TmetricDuration, "\n"),
+			strings.Trim(row.OpenProjectEntry, "\n"),
+			strings.Trim(row.OpenProjectDuration, "\n"),
+			row.DiffInTime,
+		})
+		outputTable.AppendSeparator()
+	}
+	outputTable.AppendRow(table.Row{
+		"",
+		"",
+		"",
+		"Total Diff",
+		"",
+		strconv.Itoa(totalTimeDiff),
+	})
+	outputTable.Render()
+	return nil
+}
+
 // diffCmd represents the diff command
 var diffCmd = &cobra.Command{
 	Use:   "diff",
@@ -73,141 +207,10 @@ var diffCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("end date is not in the format YYYY-MM-DD")
 		}
-		return nil
+		return checkProfileFlags()
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		config := config.NewConfig()
-
-		tmetricUserMe := tmetric.NewUser()
-		var tmetricUser tmetric.User
-		if userNameFromCmd == "" {
-			tmetricUser = tmetricUserMe
-		} else {
-			var err error
-			tmetricUser, err = tmetric.FindUserByName(config, tmetricUserMe, userNameFromCmd)
-			if err != nil {
-				_, _ = fmt.Fprint(os.Stderr, err)
-				os.Exit(1)
-			}
-		}
-
-		tmetricTimeEntries, err := tmetric.GetAllTimeEntries(config, tmetricUser, startDate, endDate)
-		if err != nil {
-			_, _ = fmt.Fprint(os.Stderr, err)
-			os.Exit(1)
-		}
-
-		var openProjectUser openproject.User
-		if userNameFromCmd != "" {
-			var err error
-			openProjectUser, err = openproject.FindUserByName(config, userNameFromCmd)
-			if err != nil {
-				_, _ = fmt.Fprint(os.Stderr, err)
-				os.Exit(1)
-			}
-		}
-
-		openProjectTimeEntries, err := openproject.GetAllTimeEntries(config, openProjectUser, startDate, endDate, nil)
-		if err != nil {
-			_, _ = fmt.Fprint(os.Stderr, err)
-			os.Exit(1)
-		}
-
-		start, _ := time.Parse("2006-01-02", startDate)
-		end, _ := time.Parse("2006-01-02", endDate)
-		outputTable := table.NewWriter()
-		outputTable.SetOutputMirror(os.Stdout)
-
-		outputTable.AppendHeader(
-			table.Row{"date", "tmetric entry", "tm\ndur", "OpenProject entry", "OP\ndur", "time\ndiff"},
-		)
-		widthContentColumns := int((getTerminalWidth() - widthOfFixedColumns) / 2)
-		outputTable.SetColumnConfigs([]table.ColumnConfig{
-			{Number: 2, WidthMax: widthContentColumns},
-			{Number: 4, WidthMax: widthContentColumns},
-		})
-
-		totalTimeDiff := 0
-		for currentDay := start; !currentDay.After(end); currentDay = currentDay.AddDate(0, 0, 1) {
-			row := tableRow{}
-			row.Date = currentDay.Format("2006-01-02")
-			sumDurationTmetric := 0
-			for _, entry := range tmetricTimeEntries {
-				entryDate, _ := time.Parse("2006-01-02", entry.StartTime[:10])
-				if entryDate.Equal(currentDay) {
-					workType, _ := entry.GetWorkType()
-					description := fmt.Sprintf("Description: %v", entry.Note)
-					project := fmt.Sprintf("- Project: %v", entry.Project.Name)
-					wpId := fmt.Sprintf("- WP ID: %v", entry.Task.ExternalLink.IssueId)
-					wp := fmt.Sprintf("- WP: %v", entry.Task.Name)
-					workType = fmt.Sprintf("- Work Type: %v", workType)
-					row.TmetricEntry += fmt.Sprintf(
-						"%v\n%v\n%v\n%v\n%v\n\n",
-						text.Snip(description, widthContentColumns, "~"),
-						text.Snip(project, widthContentColumns, "~"),
-						text.Snip(wpId, widthContentColumns, "~"),
-						text.Snip(wp, widthContentColumns, "~"),
-						text.Snip(workType, widthContentColumns, "~"),
-					)
-					duration, _ := entry.GetDuration()
-					sumDurationTmetric += int(duration.Minutes())
-					humanReadableDuration, _ := entry.GetHumanReadableDuration()
-
-					row.TmetricDuration += fmt.Sprintf("%v\n\n\n\n\n\n", humanReadableDuration)
-				}
-			}
-			sumDurationOpenProject := 0
-			for _, entry := range openProjectTimeEntries {
-				entryDate, _ := time.Parse("2006-01-02", entry.SpentOn)
-				if entryDate.Equal(currentDay) {
-					comment := fmt.Sprintf("Comment: %v", entry.Comment.Raw)
-					project := fmt.Sprintf("- Project: %v", entry.Links.Project.Title)
-					wpId := fmt.Sprintf("- WP ID: #%v", path.Base(entry.Links.WorkPackage.Href))
-					wp := fmt.Sprintf("- WP: %v", entry.Links.WorkPackage.Title)
-					activity := fmt.Sprintf("- Activity: %v", entry.Links.Activity.Title)
-					row.OpenProjectEntry += fmt.Sprintf(
-						"%v\n%v\n%v\n%v\n%v\n\n",
-						text.Snip(comment, widthContentColumns, "~"),
-						text.Snip(project, widthContentColumns, "~"),
-						text.Snip(wpId, widthContentColumns, "~"),
-						text.Snip(wp, widthContentColumns, "~"),
-						text.Snip(activity, widthContentColumns, "~"),
-					)
-					duration, _ := entry.GetDuration()
-					sumDurationOpenProject += int(duration.Minutes())
-					humanReadableDuration, _ := entry.GetHumanReadableDuration()
-					row.OpenProjectDuration += fmt.Sprintf("%v\n\n\n\n\n\n", humanReadableDuration)
-				}
-			}
-			if sumDurationTmetric > sumDurationOpenProject {
-				diff := sumDurationTmetric - sumDurationOpenProject
-				row.DiffInTime = strconv.Itoa(diff)
-				totalTimeDiff += diff
-			} else {
-				diff := sumDurationOpenProject - sumDurationTmetric
-				row.DiffInTime = strconv.Itoa(diff)
-				totalTimeDiff += diff
-			}
-
-			outputTable.AppendRow(table.Row{
-				row.Date,
-				strings.Trim(row.TmetricEntry, "\n"),
-				strings.Trim(row.TmetricDuration, "\n"),
-				strings.Trim(row.OpenProjectEntry, "\n"),
-				strings.Trim(row.OpenProjectDuration, "\n"),
-				row.DiffInTime,
-			})
-			outputTable.AppendSeparator()
-		}
-		outputTable.AppendRow(table.Row{
-			"",
-			"",
-			"",
-			"Total Diff",
-			"",
-			strconv.Itoa(totalTimeDiff),
-		})
-		outputTable.Render()
+		runForProfiles(showDiff)
 	},
 }
 
@@ -223,4 +226,7 @@ func init() {
 	diffCmd.Flags().StringVarP(
 		&userNameFromCmd, "user", "u", "", "name of the user that should be checked",
 	)
+	diffCmd.Flags().BoolVar(
+		&allProfiles, "all-profiles", false, "show the difference for every profile in the config file one after the other",
+	)
 }
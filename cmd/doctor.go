@@ -0,0 +1,484 @@
+/*
+Copyright © 2024 JankariTech Pvt. Ltd. info@jankaritech.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/spf13/cobra"
+)
+
+type checkStatus string
+
+const (
+	checkPassed  checkStatus = "✔️"
+	checkFailed  checkStatus = "❌"
+	checkWarning checkStatus = "⚠️"
+	checkSkipped checkStatus = "➖"
+)
+
+// oldTmetricExternalTaskLink is the link of the external tasks in tmetric that was used by all versions
+// before 'tmetric.externalTaskLink' could be set
+const oldTmetricExternalTaskLink = "https://community.openproject.org/"
+
+type checkResult struct {
+	name    string
+	status  checkStatus
+	details string
+	hint    string
+}
+
+// doctor runs the checks one after the other, checks that need the result of a failed check are skipped
+type doctor struct {
+	config      *config.Config
+	tmetricUser tmetric.User
+	results     []checkResult
+}
+
+func (d *doctor) pass(name string, details string) {
+	d.results = append(d.results, checkResult{name: name, status: checkPassed, details: details})
+}
+
+func (d *doctor) fail(name string, details string, hint string) {
+	d.results = append(d.results, checkResult{name: name, status: checkFailed, details: details, hint: hint})
+}
+
+func (d *doctor) warn(name string, details string, hint string) {
+	d.results = append(d.results, checkResult{name: name, status: checkWarning, details: details, hint: hint})
+}
+
+func (d *doctor) skip(name string, details string) {
+	d.results = append(d.results, checkResult{name: name, status: checkSkipped, details: details})
+}
+
+// skipped returns the names of the checks that were skipped
+func (d *doctor) skipped() []string {
+	var names []string
+	for _, result := range d.results {
+		if result.status == checkSkipped {
+			names = append(names, result.name)
+		}
+	}
+	return names
+}
+
+func (d *doctor) failed() bool {
+	for _, result := range d.results {
+		if result.status == checkFailed {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *doctor) checkOpenProjectLogin() bool {
+	const name = "OpenProject login"
+	user, err := openproject.GetCurrentUser(d.config)
+	if err != nil {
+		d.fail(name, err.Error(), "check 'openproject.url' and 'openproject.token' in the config file")
+		return false
+	}
+	d.pass(name, fmt.Sprintf("logged in to %v as '%v'", d.config.OpenProjectUrl, user.Name))
+	return true
+}
+
+func (d *doctor) checkTmetricLogin() bool {
+	const name = "tmetric login"
+	tmetricUser, err := tmetric.NewUser(d.config)
+	if err != nil {
+		d.fail(name, err.Error(), "check 'tmetric.token' in the config file")
+		return false
+	}
+	d.tmetricUser = tmetricUser
+	d.pass(name, fmt.Sprintf("logged in as '%v'", tmetricUser.Name))
+	return true
+}
+
+func (d *doctor) checkTmetricClient() {
+	const name = "tmetric client"
+	clients, err := tmetric.GetAllClients(d.config, d.tmetricUser)
+	if err != nil {
+		d.fail(name, err.Error(), "")
+		return
+	}
+	clientIds := slices.Concat(d.config.EntryFilter.ClientIds, d.config.EntryFilter.Exclude.ClientIds)
+	if d.config.ClientIdInTmetric != 0 {
+		clientIds = append([]int{d.config.ClientIdInTmetric}, clientIds...)
+	}
+	var clientNames []string
+	var missingClientIds []string
+	for _, clientId := range clientIds {
+		found := false
+		for _, client := range clients {
+			if client.Id == clientId {
+				clientNames = append(clientNames, fmt.Sprintf("'%v'", client.Name))
+				found = true
+				break
+			}
+		}
+		if !found {
+			missingClientIds = append(missingClientIds, strconv.Itoa(clientId))
+		}
+	}
+	if len(missingClientIds) > 0 {
+		d.fail(
+			name,
+			fmt.Sprintf("there is no client with the id %v in tmetric", strings.Join(missingClientIds, ", ")),
+			"set 'tmetric.clientId' and the client ids in 'tmetric.filter' to the ids of existing clients, "+
+				"e.g. with the 'config init' command",
+		)
+		return
+	}
+	if len(clientNames) == 0 {
+		d.skip(name, "the entries are selected by project only")
+		return
+	}
+	d.pass(name, strings.Join(clientNames, ", "))
+}
+
+// checkTmetricFilterProjects checks that the projects in the filter exist, a typo would silently select nothing
+func (d *doctor) checkTmetricFilterProjects() {
+	const name = "tmetric filter projects"
+	filterProjects := slices.Concat(d.config.EntryFilter.Projects, d.config.EntryFilter.Exclude.Projects)
+	if len(filterProjects) == 0 {
+		d.skip(name, "no projects in 'tmetric.filter'")
+		return
+	}
+	projects, err := tmetric.GetAllProjects(d.config, d.tmetricUser)
+	if err != nil {
+		d.fail(name, err.Error(), "")
+		return
+	}
+	var missingProjects []string
+	for _, filterProject := range filterProjects {
+		filterProject = strings.TrimSpace(filterProject)
+		found := false
+		for _, project := range projects {
+			if filterProject == strconv.Itoa(project.Id) || strings.EqualFold(filterProject, project.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missingProjects = append(missingProjects, fmt.Sprintf("'%v'", filterProject))
+		}
+	}
+	if len(missingProjects) > 0 {
+		d.fail(
+			name,
+			fmt.Sprintf("there is no project %v in tmetric", strings.Join(missingProjects, ", ")),
+			"use the ids or the names of existing projects in 'tmetric.filter'",
+		)
+		return
+	}
+	d.pass(name, fmt.Sprintf("all %v projects exist", len(filterProjects)))
+}
+
+func (d *doctor) checkTmetricDummyProject() {
+	const name = "tmetric dummy project"
+	projects, err := tmetric.GetAllProjects(d.config, d.tmetricUser)
+	if err != nil {
+		d.fail(name, err.Error(), "")
+		return
+	}
+	for _, project := range projects {
+		if project.Id == d.config.TmetricDummyProjectId {
+			d.pass(name, fmt.Sprintf("'%v'", project.Name))
+			return
+		}
+	}
+	d.fail(
+		name,
+		fmt.Sprintf("there is no project with the id %v in tmetric", d.config.TmetricDummyProjectId),
+		"ask the admin of the tmetric account to create a dummy project "+
+			"and set 'tmetric.dummyProjectId' to its id, e.g. with the 'config init' command",
+	)
+}
+
+func (d *doctor) checkTmetricTag() {
+	const name = "tmetric tag"
+	tags, err := tmetric.GetAllTags(d.config, d.tmetricUser)
+	if err != nil {
+		d.fail(name, err.Error(), "")
+		return
+	}
+	for _, tag := range tags {
+		if tag.Name == d.config.TmetricTagTransferredToOpenProject && !tag.IsWorkType {
+			d.pass(name, fmt.Sprintf("'%v' exists", tag.Name))
+			return
+		}
+	}
+	d.fail(
+		name,
+		fmt.Sprintf("there is no tag '%v' in tmetric", d.config.TmetricTagTransferredToOpenProject),
+		fmt.Sprintf(
+			"ask the admin of the tmetric account to create the tag '%v', it must not be a work type",
+			d.config.TmetricTagTransferredToOpenProject,
+		),
+	)
+}
+
+// checkTmetricExternalTaskLink warns if tasks in tmetric link to OpenProject with the link that was used
+// before 'tmetric.externalTaskLink' could be set. Those entries are not seen as linked anymore
+func (d *doctor) checkTmetricExternalTaskLink() {
+	const name = "tmetric external task link"
+	if d.config.TmetricExternalTaskLink == oldTmetricExternalTaskLink {
+		d.pass(name, fmt.Sprintf("'%v'", d.config.TmetricExternalTaskLink))
+		return
+	}
+	timeEntries, err := tmetric.GetAllTimeEntries(d.config, d.tmetricUser, startDate, endDate)
+	if err != nil {
+		d.fail(name, err.Error(), "")
+		return
+	}
+	oldLinks := 0
+	for _, entry := range timeEntries {
+		if strings.HasPrefix(entry.Task.ExternalLink.Link, oldTmetricExternalTaskLink+"work_packages") {
+			oldLinks++
+		}
+	}
+	if oldLinks > 0 {
+		d.warn(
+			name,
+			fmt.Sprintf(
+				"%v tmetric entries link to '%v', but 'tmetric.externalTaskLink' is '%v'",
+				oldLinks, oldTmetricExternalTaskLink, d.config.TmetricExternalTaskLink,
+			),
+			fmt.Sprintf(
+				"if the OpenProject integration of tmetric is set up for '%v', "+
+					"set 'tmetric.externalTaskLink' to it in the config file",
+				oldTmetricExternalTaskLink,
+			),
+		)
+		return
+	}
+	d.pass(name, fmt.Sprintf("'%v'", d.config.TmetricExternalTaskLink))
+}
+
+// checkOpenProjectActivities checks that time can be logged on the work packages that the tmetric entries
+// of the time period are linked to, and that every work type of the tmetric account can be mapped to an activity
+// that is allowed in the projects of these work packages, with the 'activities' mapping, the activity with the same
+// name or the default activity
+func (d *doctor) checkOpenProjectActivities() {
+	const timeAndCostsName = "OpenProject 'Time and costs'"
+	const workTypesName = "work types match activities"
+	workTypes, err := tmetric.GetAllWorkTypes(d.config, d.tmetricUser)
+	if err != nil {
+		d.fail(workTypesName, err.Error(), "")
+		workTypes = nil
+	}
+	timeEntries, err := tmetric.GetAllTimeEntries(d.config, d.tmetricUser, startDate, endDate)
+	if err != nil {
+		d.fail(timeAndCostsName, err.Error(), "")
+		if workTypes != nil {
+			d.skip(workTypesName, "needs the tmetric entries of the time period")
+		}
+		return
+	}
+	var linkedEntries []tmetric.TimeEntry
+	for _, entry := range timeEntries {
+		if len(tmetric.GetEntriesWithoutLinkToOpenProject(d.config, []tmetric.TimeEntry{entry})) == 0 {
+			linkedEntries = append(linkedEntries, entry)
+		}
+	}
+	// the allowed activities and the mapping can differ per project,
+	// so the projects are taken from the work packages the entries are linked to
+	if len(linkedEntries) == 0 {
+		details := fmt.Sprintf(
+			"not checked, no tmetric entries linked to OpenProject between %v and %v", startDate, endDate,
+		)
+		d.skip(timeAndCostsName, details)
+		if workTypes != nil {
+			d.skip(workTypesName, fmt.Sprintf(
+				"%v work types found in tmetric, but not checked, there are no projects in OpenProject to check "+
+					"them against, as no tmetric entries are linked to OpenProject between %v and %v",
+				len(workTypes), startDate, endDate,
+			))
+		}
+		return
+	}
+
+	activities := newActivityCache(linkedEntries, d.config)
+	seenWorkPackages := map[int]struct{}{}
+	var checkedWorkPackages []int
+	var failedWorkPackageNames []string
+	for _, entry := range linkedEntries {
+		workPackageId, _ := entry.GetIssueIdAsInt()
+		if _, seen := seenWorkPackages[workPackageId]; seen {
+			continue
+		}
+		seenWorkPackages[workPackageId] = struct{}{}
+		allowedActivities, err := activities.GetAllowedActivities(*d.config, workPackageId)
+		if err != nil || len(allowedActivities) == 0 {
+			failedWorkPackageNames = append(failedWorkPackageNames, fmt.Sprintf("#%v", workPackageId))
+			continue
+		}
+		checkedWorkPackages = append(checkedWorkPackages, workPackageId)
+	}
+	if len(failedWorkPackageNames) > 0 {
+		d.fail(
+			timeAndCostsName,
+			fmt.Sprintf("cannot log time on the work packages %v", strings.Join(failedWorkPackageNames, ", ")),
+			"enable the module 'Time and costs' and at least one activity in the projects of these work packages",
+		)
+	} else {
+		d.pass(timeAndCostsName, fmt.Sprintf("time can be logged on all %v work packages", len(checkedWorkPackages)))
+	}
+
+	if workTypes == nil {
+		return
+	}
+	if len(workTypes) == 0 {
+		d.warn(workTypesName, "there are no work types in tmetric", "ask the admin of the tmetric account to create them")
+		return
+	}
+	if len(checkedWorkPackages) == 0 {
+		d.skip(workTypesName, "not checked, time cannot be logged on any of the linked work packages")
+		return
+	}
+	// every work type is checked, not only the ones used in the time period, as they can be used any time
+	var mappingErrors []error
+	for _, workPackageId := range checkedWorkPackages {
+		for _, workType := range workTypes {
+			_, err = activities.NewActivityFromWorkType(*d.config, workPackageId, workType.Name)
+			if err != nil {
+				mappingErrors = append(mappingErrors, err)
+			}
+		}
+	}
+	if len(mappingErrors) > 0 {
+		d.fail(
+			workTypesName,
+			strings.Join(describeUnmappedWorkTypes(mappingErrors), "\n"),
+			"map the work types to activities in the 'activities' section of the config file, "+
+				"set a default activity, or rename the work types in tmetric or the activities in OpenProject",
+		)
+		return
+	}
+	d.pass(workTypesName, fmt.Sprintf(
+		"all %v work types have an activity in the projects of %v work packages",
+		len(workTypes), len(checkedWorkPackages),
+	))
+}
+
+func (d *doctor) run() {
+	openProjectLoginPassed := d.checkOpenProjectLogin()
+	if !d.checkTmetricLogin() {
+		for _, name := range []string{
+			"tmetric client", "tmetric filter projects", "tmetric dummy project", "tmetric tag",
+			"tmetric external task link", "OpenProject 'Time and costs'", "work types match activities",
+		} {
+			d.skip(name, "needs the tmetric login")
+		}
+		return
+	}
+	d.checkTmetricClient()
+	d.checkTmetricFilterProjects()
+	d.checkTmetricDummyProject()
+	d.checkTmetricTag()
+	d.checkTmetricExternalTaskLink()
+	if !openProjectLoginPassed {
+		d.skip("OpenProject 'Time and costs'", "needs the OpenProject login")
+		d.skip("work types match activities", "needs the OpenProject login")
+		return
+	}
+	d.checkOpenProjectActivities()
+}
+
+func (d *doctor) printResults() {
+	outputTable := table.NewWriter()
+	outputTable.SetOutputMirror(os.Stdout)
+	outputTable.AppendHeader(table.Row{"", "check", "details", "how to fix"})
+	widthContentColumns := int(getTerminalWidth()) - 40
+	outputTable.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 3, WidthMax: widthContentColumns / 2, WidthMaxEnforcer: text.WrapSoft},
+		{Number: 4, WidthMax: widthContentColumns / 2, WidthMaxEnforcer: text.WrapSoft},
+	})
+	for _, result := range d.results {
+		outputTable.AppendRow(table.Row{result.status, result.name, strings.TrimSpace(result.details), result.hint})
+	}
+	outputTable.Render()
+	if skipped := d.skipped(); len(skipped) > 0 {
+		fmt.Printf(
+			"%v checks were skipped, the setup is not verified completely: %v\n",
+			len(skipped), strings.Join(skipped, ", "),
+		)
+	}
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "check that everything is set up correctly in tmetric and OpenProject",
+	Long: `Checks the configuration, the logins to tmetric and OpenProject, the clients, the dummy project,
+the tag and the links of the tasks in tmetric, that 'Time and costs' is enabled in the OpenProject projects the tmetric entries
+are linked to, and that every work type in tmetric can be mapped to an activity that is allowed
+in these projects, using the 'activities' mapping and default of the config.
+Checks that need tmetric entries linked to OpenProject in the time period are skipped if there are none.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		_, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("start date is not in the format YYYY-MM-DD")
+		}
+		_, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("end date is not in the format YYYY-MM-DD")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadProfile(profileName)
+		d := doctor{config: config}
+		if err != nil {
+			d.fail("config file", err.Error(), "run 'config init' or fix the config file")
+			d.printResults()
+			os.Exit(1)
+		}
+		d.pass("config file", "all settings are valid")
+
+		spinner := newSpinner()
+		spinner.Prefix = "running checks "
+		spinner.Start()
+		d.run()
+		spinner.Stop()
+
+		d.printResults()
+		if d.failed() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	firstDayOfMonth := time.Now().AddDate(0, 0, -time.Now().Day()+1).Format("2006-01-02")
+
+	doctorCmd.Flags().StringVarP(&startDate, "start", "s", firstDayOfMonth, "start date")
+	today := time.Now().Format("2006-01-02")
+	doctorCmd.Flags().StringVarP(&endDate, "end", "e", today, "end date")
+}
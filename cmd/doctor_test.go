@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// newDoctorTestServer returns a server that acts as OpenProject and tmetric. The tag to mark transferred entries
+// only exists if withTag is set, and one of the time entries still links to the old external task link
+func newDoctorTestServer(t *testing.T, withTag bool) *httptest.Server {
+	tags := `[{"tagId":1,"tagName":"Development","isWorkType":true}]`
+	if withTag {
+		tags = `[{"tagId":1,"tagName":"Development","isWorkType":true},` +
+			`{"tagId":2,"tagName":"transferred-to-openproject","isWorkType":false}]`
+	}
+	timeEntry := `{"id":%v,"startTime":"2024-05-10T09:00:00","endTime":"2024-05-10T10:00:00",` +
+		`"project":{"id":3,"name":"Website","client":{"id":5}},"tags":[{"name":"Development","isWorkType":true}],` +
+		`"task":{"id":7,"externalLink":{"issueId":"#12","link":"%vwork_packages/12"}}}`
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/users/me":
+			w.Write([]byte(`{"id":1,"name":"Peter Pan"}`))
+		case "/api/v3/work_packages":
+			w.Write([]byte(`{"_embedded":{"elements":[]}}`))
+		case "/api/v3/time_entries/form":
+			w.Write([]byte(`{"_embedded":{"schema":{"activity":{"_embedded":{"allowedValues":[
+				{"id":3,"name":"Development"}
+			]}}}}}`))
+		case "/v3/user":
+			w.Write([]byte(`{"id":1,"name":"Peter Pan","activeAccountId":2}`))
+		case "/v3/accounts/2/timeentries":
+			_, _ = fmt.Fprintf(
+				w, "[%v,%v]",
+				fmt.Sprintf(timeEntry, 1, "https://op.example.com/"),
+				fmt.Sprintf(timeEntry, 2, oldTmetricExternalTaskLink),
+			)
+		case "/accounts/2/clients":
+			w.Write([]byte(`[{"clientId":5,"clientName":"ACME"}]`))
+		case "/accounts/2/projects":
+			w.Write([]byte(`[{"projectId":9,"projectName":"dummy"}]`))
+		case "/accounts/2/tags":
+			w.Write([]byte(tags))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(mockServer.Close)
+	return mockServer
+}
+
+func TestDoctor_run(t *testing.T) {
+	startDate, endDate = "2024-05-01", "2024-05-31"
+	mockServer := newDoctorTestServer(t, false)
+	d := doctor{config: &config.Config{
+		OpenProjectUrl:                     mockServer.URL,
+		OpenProjectToken:                   "dummyToken",
+		TmetricToken:                       "dummyToken",
+		TmetricAPIBaseUrl:                  mockServer.URL + "/",
+		TmetricAPIV3BaseUrl:                mockServer.URL + "/v3/",
+		TmetricExternalTaskLink:            "https://op.example.com/",
+		TmetricTagTransferredToOpenProject: "transferred-to-openproject",
+		ClientIdInTmetric:                  5,
+		TmetricDummyProjectId:              9,
+	}}
+
+	d.run()
+	statuses := map[string]checkStatus{}
+	for _, result := range d.results {
+		statuses[result.name] = result.status
+	}
+	assert.Equal(t, map[string]checkStatus{
+		"OpenProject login":            checkPassed,
+		"tmetric login":                checkPassed,
+		"tmetric client":               checkPassed,
+		"tmetric filter projects":      checkSkipped,
+		"tmetric dummy project":        checkPassed,
+		"tmetric tag":                  checkFailed,
+		"tmetric external task link":   checkWarning,
+		"OpenProject 'Time and costs'": checkPassed,
+		"work types match activities":  checkPassed,
+	}, statuses)
+	assert.True(t, d.failed())
+}
+
+// TestDoctorCmd runs the doctor in a separate process, so that its exit status can be checked
+func TestDoctorCmd(t *testing.T) {
+	if fakeUrl := os.Getenv("DOCTOR_TEST_FAKE_URL"); fakeUrl != "" {
+		viper.Set("openproject.url", fakeUrl)
+		viper.Set("openproject.token", "dummyToken")
+		viper.Set("tmetric.token", "dummyToken")
+		viper.Set("tmetric.clientId", 5)
+		viper.Set("tmetric.dummyProjectId", 9)
+		viper.Set("tmetric.apiBaseUrl", fakeUrl+"/")
+		viper.Set("tmetric.apiV3BaseUrl", fakeUrl+"/v3/")
+		viper.Set("tmetric.externalTaskLink", "https://op.example.com/")
+		viper.Set("state.file", os.Getenv("DOCTOR_TEST_STATE_FILE"))
+		startDate, endDate = "2024-05-01", "2024-05-31"
+		doctorCmd.Run(doctorCmd, nil)
+		return
+	}
+
+	tests := []struct {
+		name         string
+		withTag      bool
+		wantTagRow   string
+		wantExitCode int
+	}{
+		{name: "a failed check", withTag: false, wantTagRow: "| ❌ | tmetric tag ", wantExitCode: 1},
+		// the old external task link is only a warning
+		{name: "only a warning", withTag: true, wantTagRow: "| ✔️ | tmetric tag ", wantExitCode: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := newDoctorTestServer(t, tt.withTag)
+			doctorProcess := exec.Command(os.Args[0], "-test.run=^TestDoctorCmd$")
+			doctorProcess.Env = append(
+				os.Environ(),
+				"DOCTOR_TEST_FAKE_URL="+mockServer.URL,
+				"DOCTOR_TEST_STATE_FILE="+filepath.Join(t.TempDir(), "state.json"),
+			)
+			output, err := doctorProcess.Output()
+
+			exitCode := 0
+			if exitError, ok := err.(*exec.ExitError); ok {
+				exitCode = exitError.ExitCode()
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantExitCode, exitCode)
+			assert.Contains(t, string(output), "| ✔️ | OpenProject login ")
+			assert.Contains(t, string(output), tt.wantTagRow)
+			assert.Contains(t, string(output), "| ⚠️ | tmetric external task link ")
+		})
+	}
+}
+
+func TestDoctor_checkOpenProjectActivities(t *testing.T) {
+	startDate, endDate = "2024-05-01", "2024-05-31"
+	tests := []struct {
+		name        string
+		timeEntries string
+		want        map[string]checkStatus
+	}{
+		{
+			name: "a work type without activity that is not used in the time period",
+			timeEntries: `[{"id":1,"startTime":"2024-05-10T09:00:00","endTime":"2024-05-10T10:00:00",` +
+				`"project":{"id":3,"name":"Website","client":{"id":5}},"tags":[{"name":"Development","isWorkType":true}],` +
+				`"task":{"id":7,"externalLink":{"issueId":"#12","link":"https://op.example.com/work_packages/12"}}}]`,
+			want: map[string]checkStatus{
+				"OpenProject 'Time and costs'": checkPassed,
+				"work types match activities":  checkFailed,
+			},
+		},
+		{
+			name:        "no entries linked to OpenProject",
+			timeEntries: `[]`,
+			want: map[string]checkStatus{
+				"OpenProject 'Time and costs'": checkSkipped,
+				"work types match activities":  checkSkipped,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/work_packages":
+					w.Write([]byte(`{"_embedded":{"elements":[]}}`))
+				case "/api/v3/time_entries/form":
+					w.Write([]byte(`{"_embedded":{"schema":{"activity":{"_embedded":{"allowedValues":[
+						{"id":3,"name":"Development"}
+					]}}}}}`))
+				case "/v3/accounts/2/timeentries":
+					w.Write([]byte(tt.timeEntries))
+				case "/accounts/2/tags":
+					w.Write([]byte(`[{"tagId":1,"tagName":"Development","isWorkType":true},` +
+						`{"tagId":3,"tagName":"Testing","isWorkType":true}]`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer mockServer.Close()
+			d := doctor{
+				config: &config.Config{
+					OpenProjectUrl:          mockServer.URL,
+					OpenProjectToken:        "dummyToken",
+					TmetricToken:            "dummyToken",
+					TmetricAPIBaseUrl:       mockServer.URL + "/",
+					TmetricAPIV3BaseUrl:     mockServer.URL + "/v3/",
+					TmetricExternalTaskLink: "https://op.example.com/",
+					ClientIdInTmetric:       5,
+				},
+				tmetricUser: tmetric.User{ActiveAccountId: 2},
+			}
+
+			d.checkOpenProjectActivities()
+			statuses := map[string]checkStatus{}
+			for _, result := range d.results {
+				statuses[result.name] = result.status
+			}
+			assert.Equal(t, tt.want, statuses)
+		})
+	}
+}
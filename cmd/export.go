@@ -25,7 +25,6 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
 	"github.com/Masterminds/sprig/v3"
@@ -52,9 +51,16 @@ var exportCmd = &cobra.Command{
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		config := config.NewConfig()
-		tmetricUser := tmetric.NewUser()
-
+		config, err := loadProfile(profileName)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		tmetricUser, err := tmetric.NewUser(config)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
 		funcMap := template.FuncMap{
 			"ArbitraryString": func(i int) string {
 				return arbitraryString[i]
@@ -0,0 +1,237 @@
+/*
+Copyright © 2024 JankariTech Pvt. Ltd. info@jankaritech.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/state"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+)
+
+// orphanedTransfer is a recorded transfer whose tmetric entry could not be found
+type orphanedTransfer struct {
+	transfer state.Transfer
+	// possibleSource is set if an entry has the recorded note and work package, but neither the recorded id nor
+	// the recorded start time. That might be the source after an edit or a different entry
+	possibleSource *tmetric.TimeEntry
+}
+
+// getTransfersWithoutTmetricEntry returns the recorded transfers in the date range whose tmetric entry does not exist
+// anymore. An entry with the recorded id or start time is the source of the transfer
+func getTransfersWithoutTmetricEntry(
+	transfers *state.Store, tmetricTimeEntries []tmetric.TimeEntry, startDate string, endDate string,
+) []orphanedTransfer {
+	var orphanedTransfers []orphanedTransfer
+	for _, transfer := range transfers.TransfersSpentBetween(startDate, endDate) {
+		entry, sureMatch, found := findEntryOfTransfer(transfer, tmetricTimeEntries, transfers)
+		if found && sureMatch {
+			continue
+		}
+		orphanedTransfer := orphanedTransfer{transfer: transfer}
+		if found {
+			orphanedTransfer.possibleSource = &entry
+		}
+		orphanedTransfers = append(orphanedTransfers, orphanedTransfer)
+	}
+	return orphanedTransfers
+}
+
+// sourceSearchMarginDays is how many days before and after the recorded start times the source entries are looked for,
+// so that an entry that was moved to another day is still found
+const sourceSearchMarginDays = 31
+
+// getSourceSearchRange returns the period in which the tmetric entries of the transfers are looked for.
+// It includes the recorded start times of the transfers and the margin around them
+func getSourceSearchRange(transfers []state.Transfer, startDate string, endDate string) (string, string) {
+	earliest, _ := time.Parse("2006-01-02", startDate)
+	latest, _ := time.Parse("2006-01-02", endDate)
+	for _, transfer := range transfers {
+		recordedStartTime, err := time.Parse("2006-01-02T15:04:05", transfer.TmetricStartTime)
+		if err != nil {
+			continue
+		}
+		if recordedStartTime.Before(earliest) {
+			earliest = recordedStartTime
+		}
+		if recordedStartTime.After(latest) {
+			latest = recordedStartTime
+		}
+	}
+	return earliest.AddDate(0, 0, -sourceSearchMarginDays).Format("2006-01-02"),
+		latest.AddDate(0, 0, sourceSearchMarginDays).Format("2006-01-02")
+}
+
+// findTransfersWithoutTmetricEntry compares the recorded transfers with all the entries of the user in tmetric.
+// The entries that the filter of the config does not select are compared too, they still exist in tmetric.
+// The entries are fetched from a wider period than the date range, because the source might have been moved
+func findTransfersWithoutTmetricEntry(
+	transfers *state.Store, tmetricUser tmetric.User, startDate string, endDate string, config *config.Config,
+) ([]orphanedTransfer, error) {
+	searchStartDate, searchEndDate := getSourceSearchRange(
+		transfers.TransfersSpentBetween(startDate, endDate), startDate, endDate,
+	)
+	tmetricTimeEntries, err := tmetric.GetTimeEntriesOfAllClients(config, tmetricUser, searchStartDate, searchEndDate)
+	if err != nil {
+		return nil, err
+	}
+	return getTransfersWithoutTmetricEntry(transfers, tmetricTimeEntries, startDate, endDate), nil
+}
+
+func handleTransfersWithoutTmetricEntry(
+	orphanedTransfers []orphanedTransfer, transfers *state.Store, config *config.Config,
+) error {
+	if len(orphanedTransfers) == 0 {
+		fmt.Println("All time entries in OpenProject still have their source in tmetric")
+		return nil
+	}
+	fmt.Println("Some time entries in OpenProject were created from time-entries that do not exist in tmetric anymore")
+
+	spinner := newSpinner()
+	defer spinner.Stop()
+	for _, orphanedTransfer := range orphanedTransfers {
+		transfer := orphanedTransfer.transfer
+		openProjectTimeEntry, err := openproject.GetTimeEntry(*config, transfer.OpenProjectEntryId)
+		if err != nil {
+			// the entry might have been deleted in OpenProject already, then only the record is outdated
+			fmt.Printf("%v\n", err)
+			prompt := promptui.Prompt{
+				Label:     fmt.Sprintf("Remove the record of OpenProject entry %v?", transfer.OpenProjectEntryId),
+				IsConfirm: true,
+			}
+			removeRecordConfirmation, _ := prompt.Run()
+			if strings.ToLower(removeRecordConfirmation) == "y" {
+				err = transfers.Remove(transfer.OpenProjectEntryId)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if orphanedTransfer.possibleSource != nil {
+			fmt.Printf(
+				"The tmetric entry '%v' starting at %v has the note and the work package of the source of "+
+					"OpenProject entry %v, but neither the id %v nor the start time %v. "+
+					"If it is the source, keep the OpenProject entry, deleting it would lose these hours\n",
+				orphanedTransfer.possibleSource.Note,
+				orphanedTransfer.possibleSource.StartTime,
+				transfer.OpenProjectEntryId,
+				transfer.TmetricEntryId,
+				transfer.TmetricStartTime,
+			)
+		}
+		humanReadableDuration, _ := openProjectTimeEntry.GetHumanReadableDuration()
+		prompt := promptui.Prompt{
+			Label: fmt.Sprintf(
+				"%v => WP: %v. Comment: %v. %v on %v. Delete OpenProject entry %v",
+				openProjectTimeEntry.Links.Project.Title,
+				openProjectTimeEntry.Links.WorkPackage.Title,
+				openProjectTimeEntry.Comment.Raw,
+				humanReadableDuration,
+				openProjectTimeEntry.SpentOn,
+				transfer.OpenProjectEntryId,
+			),
+			IsConfirm: true,
+		}
+		deleteConfirmation, _ := prompt.Run()
+		if strings.ToLower(deleteConfirmation) != "y" {
+			fmt.Println("skipping")
+			continue
+		}
+
+		spinner.Start()
+		spinner.Prefix = fmt.Sprintf("Deleting OpenProject entry %v ", transfer.OpenProjectEntryId)
+		spinner.FinalMSG = "❌\n"
+		err = openproject.DeleteTimeEntry(*config, transfer.OpenProjectEntryId)
+		if err != nil {
+			return err
+		}
+		err = transfers.Remove(transfer.OpenProjectEntryId)
+		if err != nil {
+			return err
+		}
+		spinner.FinalMSG = "✔️\n"
+		spinner.Stop()
+	}
+	return nil
+}
+
+// reconcileCmd represents the reconcile command
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "delete time entries in OpenProject whose tmetric entry was deleted",
+	Long: `Finds time entries in OpenProject that were created by the 'copy' command,
+but whose source entry does not exist in tmetric anymore, and deletes them after a confirmation.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		_, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("start date is not in the format YYYY-MM-DD")
+		}
+		_, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("end date is not in the format YYYY-MM-DD")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadProfile(profileName)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		tmetricUser, err := tmetric.NewUser(config)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		transfers, err := state.Load(config.StateFile)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		orphanedTransfers, err := findTransfersWithoutTmetricEntry(transfers, tmetricUser, startDate, endDate, config)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = handleTransfersWithoutTmetricEntry(orphanedTransfers, transfers, config)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reconcileCmd)
+
+	firstDayOfMonth := time.Now().AddDate(0, 0, -time.Now().Day()+1).Format("2006-01-02")
+
+	reconcileCmd.Flags().StringVarP(&startDate, "start", "s", firstDayOfMonth, "start date")
+	today := time.Now().Format("2006-01-02")
+	reconcileCmd.Flags().StringVarP(&endDate, "end", "e", today, "end date")
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/state"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindTransfersWithoutTmetricEntry(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"id":1,"startTime":"2024-05-10T09:00:00","project":{"id":7,"name":"synced","client":{"id":5}}},
+			{"id":2,"startTime":"2024-05-10T11:00:00","project":{"id":8,"name":"internal","client":{"id":5}}},
+			{"id":6,"startTime":"2024-05-11T08:00:00","note":"coding","project":{"id":7,"name":"synced","client":{"id":5}},
+				"task":{"id":3,"externalLink":{"issueId":"#12"}}},
+			{"id":7,"startTime":"2024-05-12T09:00:00","project":{"id":7,"name":"synced","client":{"id":5}}},
+			{"id":8,"startTime":"2024-05-13T09:00:00","project":{"id":7,"name":"synced","client":{"id":5}}}
+		]`))
+	}))
+	defer mockServer.Close()
+	config := config.Config{
+		TmetricToken:        "dummyToken",
+		TmetricAPIV3BaseUrl: mockServer.URL + "/",
+		ClientIdInTmetric:   5,
+	}
+	// the entry was transferred before the project was excluded from syncing
+	config.EntryFilter.Exclude.Projects = []string{"internal"}
+	transfers, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	for _, transfer := range []state.Transfer{
+		{TmetricEntryId: 1, TmetricStartTime: "2024-05-10T09:00:00", OpenProjectEntryId: 10, SpentOn: "2024-05-10"},
+		{TmetricEntryId: 2, TmetricStartTime: "2024-05-10T11:00:00", OpenProjectEntryId: 20, SpentOn: "2024-05-10"},
+		{TmetricEntryId: 3, TmetricStartTime: "2024-05-10T13:00:00", OpenProjectEntryId: 30, SpentOn: "2024-05-10"},
+		// the start time was changed in tmetric, that gave the entry the new id 6, only its note and task are the same
+		{
+			TmetricEntryId: 4, TmetricStartTime: "2024-05-10T15:00:00", TmetricNote: "coding", WorkPackageId: 12,
+			OpenProjectEntryId: 40, SpentOn: "2024-05-10",
+		},
+		// the entry was deleted, the source of another transfer starts at the same time
+		{TmetricEntryId: 5, TmetricStartTime: "2024-05-12T09:00:00", OpenProjectEntryId: 50, SpentOn: "2024-05-12"},
+		{TmetricEntryId: 7, TmetricStartTime: "2024-05-12T09:00:00", OpenProjectEntryId: 70, SpentOn: "2024-05-12"},
+		// the entry got a new id, but still starts at the same time
+		{TmetricEntryId: 9, TmetricStartTime: "2024-05-13T09:00:00", OpenProjectEntryId: 90, SpentOn: "2024-05-13"},
+	} {
+		assert.NoError(t, transfers.Record(transfer))
+	}
+
+	orphanedTransfers, err := findTransfersWithoutTmetricEntry(
+		transfers, tmetric.User{ActiveAccountId: 2}, "2024-05-01", "2024-05-31", &config,
+	)
+	assert.NoError(t, err)
+	if assert.Len(t, orphanedTransfers, 3) {
+		assert.Equal(t, orphanedTransfer{transfer: transfers.Transfers[2]}, orphanedTransfers[0])
+		assert.Equal(t, transfers.Transfers[3], orphanedTransfers[1].transfer)
+		if assert.NotNil(t, orphanedTransfers[1].possibleSource) {
+			assert.Equal(t, 6, orphanedTransfers[1].possibleSource.Id)
+		}
+		assert.Equal(t, orphanedTransfer{transfer: transfers.Transfers[4]}, orphanedTransfers[2])
+	}
+}
+
+func TestFindTransfersWithoutTmetricEntry_sourceMovedOutsideRange(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// like tmetric, only the entries in the requested period are returned
+		if r.URL.Query().Get("endDate") < "2024-06-03" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[
+			{"id":1,"startTime":"2024-06-03T09:00:00","project":{"id":7,"name":"synced","client":{"id":5}}}
+		]`))
+	}))
+	defer mockServer.Close()
+	config := config.Config{
+		TmetricToken:        "dummyToken",
+		TmetricAPIV3BaseUrl: mockServer.URL + "/",
+		ClientIdInTmetric:   5,
+	}
+	transfers, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	// the entry was moved from the end of May to June after it had been transferred
+	assert.NoError(t, transfers.Record(state.Transfer{
+		TmetricEntryId: 1, TmetricStartTime: "2024-05-31T09:00:00", OpenProjectEntryId: 10, SpentOn: "2024-05-31",
+	}))
+
+	orphanedTransfers, err := findTransfersWithoutTmetricEntry(
+		transfers, tmetric.User{ActiveAccountId: 2}, "2024-05-01", "2024-05-31", &config,
+	)
+	assert.NoError(t, err)
+	assert.Empty(t, orphanedTransfers)
+}
+
+func TestGetSourceSearchRange(t *testing.T) {
+	tests := []struct {
+		name          string
+		transfers     []state.Transfer
+		wantStartDate string
+		wantEndDate   string
+	}{
+		{name: "no transfers", wantStartDate: "2024-04-30", wantEndDate: "2024-07-01"},
+		{
+			name:          "recorded start times outside the date range",
+			transfers:     []state.Transfer{{TmetricStartTime: "2024-04-28T23:00:00"}, {TmetricStartTime: "2024-06-02T01:00:00"}},
+			wantStartDate: "2024-03-28",
+			wantEndDate:   "2024-07-03",
+		},
+		{
+			name:          "invalid start time",
+			transfers:     []state.Transfer{{TmetricStartTime: "yesterday"}},
+			wantStartDate: "2024-04-30",
+			wantEndDate:   "2024-07-01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searchStartDate, searchEndDate := getSourceSearchRange(tt.transfers, "2024-05-31", "2024-05-31")
+			assert.Equal(t, tt.wantStartDate, searchStartDate)
+			assert.Equal(t, tt.wantEndDate, searchEndDate)
+		})
+	}
+}
@@ -19,8 +19,12 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
 	"github.com/briandowns/spinner"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -28,8 +32,11 @@ import (
 )
 
 var cfgFile string
+var profileName string
+var allProfiles bool
 var startDate string
 var endDate string
+var debugHttp bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -58,6 +65,12 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.OpenProjectTmetricIntegration.yaml)")
+	rootCmd.PersistentFlags().StringVar(
+		&profileName, "profile", "", "name of the profile in the config file whose settings should be used",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&debugHttp, "debug-http", false, "print all HTTP requests and responses (tokens are redacted)",
+	)
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -76,7 +89,9 @@ func initConfig() {
 		viper.SetConfigName(".OpenProjectTmetricIntegration")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// read in environment variables that match, e.g. TMETRIC_APIBASEURL for tmetric.apiBaseUrl
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
@@ -88,3 +103,84 @@ func initConfig() {
 func newSpinner() *spinner.Spinner {
 	return spinner.New(spinner.CharSets[7], 100*time.Millisecond)
 }
+
+// newActivityCache returns a cache for the allowed activities that knows the projects of the work packages
+// the time entries are linked to already. If the projects cannot be looked up the cache still works, just with
+// more requests
+func newActivityCache(timeEntries []tmetric.TimeEntry, config *config.Config) *openproject.ActivityCache {
+	activities := openproject.NewActivityCache()
+	workPackageIdSet := map[int]struct{}{}
+	var workPackageIds []int
+	for _, entry := range timeEntries {
+		workPackageId, err := entry.GetIssueIdAsInt()
+		if err != nil {
+			continue
+		}
+		if _, found := workPackageIdSet[workPackageId]; !found {
+			workPackageIdSet[workPackageId] = struct{}{}
+			workPackageIds = append(workPackageIds, workPackageId)
+		}
+	}
+	err := activities.Prefetch(*config, workPackageIds)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "could not look up the projects of the work packages: %v\n", err)
+	}
+	return activities
+}
+
+// checkProfileFlags returns an error if a single profile and all profiles are requested at the same time
+func checkProfileFlags() error {
+	if allProfiles && profileName != "" {
+		return fmt.Errorf("--profile and --all-profiles cannot be used together")
+	}
+	return nil
+}
+
+// loadProfile loads the settings of the profile. The --debug-http flag has to win over the 'http.debug' setting
+// of the profile as well, so it's applied after the profile was resolved
+func loadProfile(name string) (*config.Config, error) {
+	config, err := config.LoadProfile(name)
+	if rootCmd.PersistentFlags().Changed("debug-http") {
+		config.HttpDebug = debugHttp
+	}
+	return config, err
+}
+
+// runForProfiles runs the command with the profile selected by the --profile flag,
+// or one after the other with every profile of the config file if --all-profiles is set.
+// An error in one profile does not stop the others, but the process exits with an error code at the end
+func runForProfiles(run func(config *config.Config) error) {
+	if !allProfiles {
+		config, err := loadProfile(profileName)
+		if err == nil {
+			err = run(config)
+		}
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	profileNames := config.ProfileNames()
+	if len(profileNames) == 0 {
+		_, _ = fmt.Fprint(os.Stderr, "there are no profiles in the config file")
+		os.Exit(1)
+	}
+	var failedProfiles []string
+	for _, name := range profileNames {
+		fmt.Printf("=== profile '%v' ===\n", name)
+		config, err := loadProfile(name)
+		if err == nil {
+			err = run(config)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			failedProfiles = append(failedProfiles, name)
+		}
+	}
+	if len(failedProfiles) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "failed profiles: %v\n", strings.Join(failedProfiles, ", "))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadProfile_debugHttpFlag(t *testing.T) {
+	tests := []struct {
+		name           string
+		profileSetting bool
+		flagValue      string
+		wantHttpDebug  bool
+	}{
+		{name: "the flag wins over the setting of the profile", flagValue: "true", wantHttpDebug: true},
+		{name: "the flag switches debugging off", profileSetting: true, flagValue: "false", wantHttpDebug: false},
+		{name: "without the flag the setting of the profile is used", profileSetting: true, wantHttpDebug: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			viper.Set("profiles.clienta.http.debug", tt.profileSetting)
+			flag := rootCmd.PersistentFlags().Lookup("debug-http")
+			t.Cleanup(func() {
+				debugHttp = false
+				flag.Changed = false
+			})
+			if tt.flagValue != "" {
+				assert.NoError(t, rootCmd.PersistentFlags().Set("debug-http", tt.flagValue))
+			}
+
+			config, _ := loadProfile("clientA")
+			assert.Equal(t, tt.wantHttpDebug, config.HttpDebug)
+		})
+	}
+}
@@ -22,91 +22,325 @@ import (
 	"fmt"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/rules"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/briandowns/spinner"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func validateOpenProjectWorkPackage(input string) error {
-	if len(input) > 0 {
-		_, err := strconv.ParseInt(input, 10, 32)
+var rulesFile string
+var nonInteractive bool
+var batch bool
+var groupBy string
+
+// unresolvedEntry is a time entry that could not be fixed by the rules
+type unresolvedEntry struct {
+	entry   tmetric.TimeEntry
+	problem string
+}
+
+func entriesOf(unresolved []unresolvedEntry) []tmetric.TimeEntry {
+	var timeEntries []tmetric.TimeEntry
+	for _, item := range unresolved {
+		timeEntries = append(timeEntries, item.entry)
+	}
+	return timeEntries
+}
+
+func describeEntry(entry tmetric.TimeEntry) string {
+	return fmt.Sprintf("%v => %v %v-%v", entry.Project.Name, entry.Note, entry.StartTime, entry.EndTime)
+}
+
+// applyWorkPackageRules links the entries without a work package to the one a rule selects.
+// It returns the entries that are still not linked
+func applyWorkPackageRules(
+	timeEntries []tmetric.TimeEntry, checkRules *rules.Rules, linker *tmetric.Linker, config *config.Config,
+) ([]unresolvedEntry, error) {
+	var unresolved []unresolvedEntry
+	for _, entry := range tmetric.GetEntriesWithoutLinkToOpenProject(config, timeEntries) {
+		workPackageId, found := checkRules.WorkPackageFor(entry)
+		if !found {
+			unresolved = append(unresolved, unresolvedEntry{entry: entry, problem: "no work package assigned"})
+			continue
+		}
+		workPackage, err := openproject.GetWorkpackage(strconv.Itoa(workPackageId), config)
+		if err != nil {
+			unresolved = append(unresolved, unresolvedEntry{
+				entry:   entry,
+				problem: fmt.Sprintf("a rule selects the work package %v, but %v", workPackageId, err),
+			})
+			continue
+		}
+		// a failing link, e.g. because of a running timer, would fail for every other entry too
+		err = linker.Link(&entry, workPackage)
 		if err != nil {
-			return errors.New("Invalid WP")
+			return nil, err
 		}
+		fmt.Printf("%v: linked to WP %v '%v' by a rule\n", describeEntry(entry), workPackage.Id, workPackage.Subject)
 	}
-	return nil
+	return unresolved, nil
 }
 
-func handleEntriesWithoutIssue(timeEntries []tmetric.TimeEntry, tmetricUser tmetric.User, config *config.Config) error {
-	entriesWithoutLinkToOpenProject := tmetric.GetEntriesWithoutLinkToOpenProject(config, timeEntries)
-	if len(entriesWithoutLinkToOpenProject) > 0 {
-		fmt.Println("Some time-entries do not have any workpackages assigned")
+// applyWorkTypeRules sets the work type a rule selects on the entries without a work type.
+// It returns the entries that still have no work type
+func applyWorkTypeRules(
+	timeEntries []tmetric.TimeEntry, checkRules *rules.Rules, tmetricUser tmetric.User, config *config.Config,
+) ([]unresolvedEntry, error) {
+	var unresolved []unresolvedEntry
+	for _, entry := range tmetric.GetEntriesWithoutWorkType(timeEntries) {
+		workTypeName, found := checkRules.WorkTypeFor(entry)
+		if !found {
+			unresolved = append(unresolved, unresolvedEntry{entry: entry, problem: "no work type assigned"})
+			continue
+		}
+		possibleWorkTypes, err := entry.GetPossibleWorkTypes(*config, tmetricUser)
+		if err != nil {
+			return nil, err
+		}
+		var workType *tmetric.Tag
+		for i := range possibleWorkTypes {
+			if strings.EqualFold(possibleWorkTypes[i].Name, workTypeName) {
+				workType = &possibleWorkTypes[i]
+				break
+			}
+		}
+		if workType == nil {
+			unresolved = append(unresolved, unresolvedEntry{
+				entry: entry,
+				problem: fmt.Sprintf(
+					"a rule selects the work type '%v', but it cannot be used in the project", workTypeName,
+				),
+			})
+			continue
+		}
+		entry.Tags = append(entry.Tags, tmetric.Tag{Name: workType.Name, IsWorkType: true})
+		err = entry.Update(*config, tmetricUser)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("%v: work type set to '%v' by a rule\n", describeEntry(entry), workType.Name)
 	}
+	return unresolved, nil
+}
 
-	spinner := newSpinner()
-	defer spinner.Stop()
+func printUnresolvedEntries(unresolved []unresolvedEntry) {
+	_, _ = fmt.Fprintf(os.Stderr, "%v time entries could not be fixed:\n", len(unresolved))
+	for _, item := range unresolved {
+		_, _ = fmt.Fprintf(os.Stderr, "- %v: %v\n", describeEntry(item.entry), item.problem)
+	}
+}
 
-	for _, entry := range entriesWithoutLinkToOpenProject {
+// recentWorkPackageDays is how many days back the work packages the user logged time on are offered
+const recentWorkPackageDays = 14
+
+// workPackageSearchLimit is the maximum number of search results that are offered
+const workPackageSearchLimit = 20
+
+// workPackageFinder lets the user select a work package from the recently used ones or by searching OpenProject
+type workPackageFinder struct {
+	config *config.Config
+	// recent are the work packages the user logged time on recently
+	recent []openproject.WorkPackage
+	// projectIds are the projects the user is a member of, the search is limited to them
+	projectIds []string
+}
+
+// newWorkPackageFinder reads the recent work packages and the projects of the user.
+// If that fails the finder still works, only with less help
+func newWorkPackageFinder(config *config.Config) *workPackageFinder {
+	finder := &workPackageFinder{config: config}
+	today := time.Now()
+	recent, err := openproject.GetRecentWorkPackages(
+		config, today.AddDate(0, 0, -recentWorkPackageDays).Format("2006-01-02"), today.Format("2006-01-02"),
+	)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "could not read the recently used work packages: %v\n", err)
+	}
+	finder.recent = recent
+	user, err := openproject.GetCurrentUser(config)
+	if err == nil {
+		finder.projectIds, err = openproject.GetMemberProjectIds(config, user)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "the search is not limited to your projects: %v\n", err)
+	}
+	return finder
+}
+
+// find returns the work package with the id or the work packages matching the search term
+func (f *workPackageFinder) find(input string) ([]openproject.WorkPackage, error) {
+	if _, err := strconv.Atoi(input); err == nil {
+		workPackage, err := openproject.GetWorkpackage(input, f.config)
+		if err != nil {
+			return nil, err
+		}
+		return []openproject.WorkPackage{workPackage}, nil
+	}
+	return openproject.SearchWorkPackages(f.config, input, f.projectIds, workPackageSearchLimit)
+}
+
+func describeWorkPackage(workPackage openproject.WorkPackage) string {
+	if workPackage.Links.Project.Title == "" {
+		return fmt.Sprintf("WP %v: %v", workPackage.Id, workPackage.Subject)
+	}
+	return fmt.Sprintf("WP %v: %v (%v)", workPackage.Id, workPackage.Subject, workPackage.Links.Project.Title)
+}
+
+// selectWorkPackage lets the user select the work package for the described entries.
+// It returns false if the user skipped them
+func (f *workPackageFinder) selectWorkPackage(description string) (openproject.WorkPackage, bool, error) {
+	const searchItem = "search..."
+	const skipItem = "skip"
+	candidates := f.recent
+	label := fmt.Sprintf("%v. Select a recently used WP or search", description)
+	for {
+		var items []string
+		for _, workPackage := range candidates {
+			items = append(items, describeWorkPackage(workPackage))
+		}
+		items = append(items, searchItem, skipItem)
+		promptSelect := promptui.Select{Label: label, Items: items, Size: 12}
+		index, _, err := promptSelect.Run()
+		if err != nil {
+			return openproject.WorkPackage{}, false, fmt.Errorf("prompt failed: %v", err)
+		}
+		if index < len(candidates) {
+			return candidates[index], true, nil
+		}
+		if items[index] == skipItem {
+			return openproject.WorkPackage{}, false, nil
+		}
+
+		promptSearch := promptui.Prompt{
+			Label: "Search term or WP number",
+			Validate: func(input string) error {
+				if strings.TrimSpace(input) == "" {
+					return errors.New("enter a search term")
+				}
+				return nil
+			},
+		}
+		searchTerm, err := promptSearch.Run()
+		if err != nil {
+			return openproject.WorkPackage{}, false, fmt.Errorf("prompt failed: %v", err)
+		}
+		searchTerm = strings.TrimSpace(searchTerm)
+		found, err := f.find(searchTerm)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			continue
+		}
+		if len(found) == 0 {
+			fmt.Printf("no work packages found for '%v'\n", searchTerm)
+			continue
+		}
+		candidates = found
+		label = fmt.Sprintf("%v. WPs matching '%v'", description, searchTerm)
+	}
+}
+
+// linkEntry links the entry to the work package while showing a spinner
+func linkEntry(
+	entry tmetric.TimeEntry, workPackage openproject.WorkPackage, linker *tmetric.Linker, spinner *spinner.Spinner,
+) error {
+	spinner.Start()
+	spinner.Prefix = fmt.Sprintf("Updating t-metric entry '%v' ", entry.Note)
+	spinner.FinalMSG = "❌\n"
+	err := linker.Link(&entry, workPackage)
+	if err != nil {
+		spinner.Stop()
+		return err
+	}
+	spinner.FinalMSG = "✔️\n"
+	spinner.Stop()
+	return nil
+}
+
+// confirmWorkPackage asks if the selected work package should be linked, a wrong selection in the list must not
+// change the entries in tmetric right away
+func confirmWorkPackage(workPackage openproject.WorkPackage) bool {
+	promptConfirm := promptui.Prompt{
+		Label: fmt.Sprintf(
+			"WP: %v. Subject: %v. Update t-metric entry?", workPackage.Id, workPackage.Subject,
+		),
+		IsConfirm: true,
+	}
+	updateTmetricConfirmation, _ := promptConfirm.Run()
+	return strings.ToLower(updateTmetricConfirmation) == "y"
+}
+
+// offerWorkPackagesFromNote offers to link the entry to the work packages its note mentions, e.g. "fixing #4711",
+// Enter accepts. It returns true if the entry was linked
+func offerWorkPackagesFromNote(
+	entry tmetric.TimeEntry, linker *tmetric.Linker, config *config.Config, spinner *spinner.Spinner,
+) (bool, error) {
+	for _, workPackageId := range entry.GetWorkPackageReferencesInNote() {
+		workPackage, err := openproject.GetWorkpackage(strconv.Itoa(workPackageId), config)
+		if err != nil {
+			// not every number after a # is a work package
+			continue
+		}
 		prompt := promptui.Prompt{
 			Label: fmt.Sprintf(
-				"%v => %v %v-%v. Provide a WP number to be assigned to this time-entry (Enter to skip)",
-				entry.Project.Name, entry.Note, entry.StartTime, entry.EndTime,
+				"%v => %v %v-%v. The note mentions WP: %v. Subject: %v. Link the entry to it",
+				entry.Project.Name, entry.Note, entry.StartTime, entry.EndTime, workPackage.Id, workPackage.Subject,
 			),
-			Validate: validateOpenProjectWorkPackage,
+			IsConfirm: true,
+			Default:   "y",
 		}
+		_, err = prompt.Run()
+		if errors.Is(err, promptui.ErrInterrupt) {
+			return false, fmt.Errorf("prompt failed: %v", err)
+		}
+		if err != nil {
+			continue
+		}
+		err = linkEntry(entry, workPackage, linker, spinner)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
 
-		workpackageFoundOnOpenProject := false
-		for !workpackageFoundOnOpenProject {
-
-			workPackageId, err := prompt.Run()
-
-			if err != nil {
-				return fmt.Errorf("prompt failed: %v", err)
-			}
+func handleEntriesWithoutIssue(timeEntries []tmetric.TimeEntry, linker *tmetric.Linker, config *config.Config) error {
+	entriesWithoutLinkToOpenProject := tmetric.GetEntriesWithoutLinkToOpenProject(config, timeEntries)
+	if len(entriesWithoutLinkToOpenProject) == 0 {
+		return nil
+	}
+	fmt.Println("Some time-entries do not have any workpackages assigned")
+	finder := newWorkPackageFinder(config)
 
-			if workPackageId == "" {
-				fmt.Println("skipping")
-				workpackageFoundOnOpenProject = true
-				continue
-			}
-			workPackage, err := openproject.GetWorkpackage(workPackageId, config)
+	spinner := newSpinner()
+	defer spinner.Stop()
 
-			if err == nil {
-				workpackageFoundOnOpenProject = true
-			} else {
-				fmt.Printf("%v\n", err)
-				continue
-			}
+	for _, entry := range entriesWithoutLinkToOpenProject {
+		linked, err := offerWorkPackagesFromNote(entry, linker, config, spinner)
+		if err != nil {
+			return err
+		}
+		if linked {
+			continue
+		}
 
-			prompt = promptui.Prompt{
-				Label: fmt.Sprintf(
-					"WP: %v. Subject: %v. Update t-metric entry?", workPackage.Id, workPackage.Subject,
-				),
-				IsConfirm: true,
-			}
-			updateTmetricConfirmation, err := prompt.Run()
-
-			if strings.ToLower(updateTmetricConfirmation) == "y" {
-				spinner.Start()
-				spinner.Prefix = fmt.Sprintf("Updating t-metric entry '%v' ", entry.Note)
-				spinner.FinalMSG = "❌\n"
-				latestTimeEntry, err := tmetric.CreateDummyTimeEntry(workPackage, tmetricUser, config)
-				if err != nil {
-					return err
-				}
-				_ = latestTimeEntry.Delete(*config, tmetricUser)
-				entry.Task = latestTimeEntry.Task
-				err = entry.Update(*config, tmetricUser)
-				if err != nil {
-					return err
-				}
-				spinner.FinalMSG = "✔️\n"
-				spinner.Stop()
-			}
+		workPackage, selected, err := finder.selectWorkPackage(describeEntry(entry))
+		if err != nil {
+			return err
+		}
+		if !selected || !confirmWorkPackage(workPackage) {
+			fmt.Println("skipping")
+			continue
+		}
+		err = linkEntry(entry, workPackage, linker, spinner)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -176,10 +410,272 @@ func handleEntriesWithoutWorkType(timeEntries []tmetric.TimeEntry, tmetricUser t
 	return nil
 }
 
+func describeGroup(group tmetric.TimeEntryGroup) string {
+	return fmt.Sprintf("%v time entries with the %v '%v'", len(group.Entries), groupBy, group.Key)
+}
+
+// handleGroupsWithoutIssue asks once for every group of entries without a work package and links the whole group
+func handleGroupsWithoutIssue(timeEntries []tmetric.TimeEntry, linker *tmetric.Linker, config *config.Config) error {
+	groups, err := tmetric.GroupTimeEntries(
+		tmetric.GetEntriesWithoutLinkToOpenProject(config, timeEntries), tmetric.GroupBy(groupBy),
+	)
+	if err != nil || len(groups) == 0 {
+		return err
+	}
+	fmt.Println("Some time-entries do not have any workpackages assigned")
+	finder := newWorkPackageFinder(config)
+
+	spinner := newSpinner()
+	defer spinner.Stop()
+	for _, group := range groups {
+		workPackage, selected, err := finder.selectWorkPackage(describeGroup(group))
+		if err != nil {
+			return err
+		}
+		if !selected || !confirmWorkPackage(workPackage) {
+			fmt.Println("skipping")
+			continue
+		}
+		spinner.Start()
+		spinner.Prefix = fmt.Sprintf("Updating %v t-metric entries ", len(group.Entries))
+		spinner.FinalMSG = "❌\n"
+		err = linker.LinkAll(group.Entries, workPackage)
+		if err != nil {
+			spinner.Stop()
+			return err
+		}
+		spinner.FinalMSG = "✔️\n"
+		spinner.Stop()
+	}
+	return nil
+}
+
+// commonWorkTypes returns the work types that can be used in the projects of all the entries
+func commonWorkTypes(
+	timeEntries []tmetric.TimeEntry, tmetricUser tmetric.User, config *config.Config,
+) ([]string, error) {
+	var workTypes []string
+	checkedProjects := map[int]bool{}
+	for i, entry := range timeEntries {
+		if checkedProjects[entry.Project.Id] {
+			continue
+		}
+		checkedProjects[entry.Project.Id] = true
+		possibleWorkTypes, err := entry.GetPossibleWorkTypes(*config, tmetricUser)
+		if err != nil {
+			return nil, err
+		}
+		var projectWorkTypes []string
+		for _, workType := range possibleWorkTypes {
+			if i == 0 || slices.Contains(workTypes, workType.Name) {
+				projectWorkTypes = append(projectWorkTypes, workType.Name)
+			}
+		}
+		workTypes = projectWorkTypes
+	}
+	return workTypes, nil
+}
+
+// handleGroupsWithoutWorkType asks once for every group of entries without a work type and sets it on the whole group
+func handleGroupsWithoutWorkType(
+	timeEntries []tmetric.TimeEntry, tmetricUser tmetric.User, config *config.Config,
+) error {
+	groups, err := tmetric.GroupTimeEntries(tmetric.GetEntriesWithoutWorkType(timeEntries), tmetric.GroupBy(groupBy))
+	if err != nil || len(groups) == 0 {
+		return err
+	}
+	fmt.Println("Some time-entries do not have any work type assigned")
+
+	spinner := newSpinner()
+	defer spinner.Stop()
+	for _, group := range groups {
+		workTypes, err := commonWorkTypes(group.Entries, tmetricUser, config)
+		if err != nil {
+			return err
+		}
+		if len(workTypes) == 0 {
+			fmt.Printf("%v: the projects have no work type in common, skipping\n", describeGroup(group))
+			continue
+		}
+		promptSelectWorkType := promptui.Select{
+			Label: fmt.Sprintf("%v. Select work-type", describeGroup(group)),
+			Items: append(workTypes, "skip"),
+		}
+		index, workType, err := promptSelectWorkType.Run()
+		if err != nil {
+			return fmt.Errorf("prompt failed: %v", err)
+		}
+		if index == len(workTypes) {
+			fmt.Println("skipping")
+			continue
+		}
+
+		spinner.Start()
+		spinner.Prefix = fmt.Sprintf("Updating %v t-metric entries ", len(group.Entries))
+		spinner.FinalMSG = "❌\n"
+		var updateErrors []error
+		for _, entry := range group.Entries {
+			entry.Tags = append(entry.Tags, tmetric.Tag{Name: workType, IsWorkType: true})
+			err = entry.Update(*config, tmetricUser)
+			if err != nil {
+				updateErrors = append(updateErrors, fmt.Errorf("entry '%v': %v", entry.Note, err))
+			}
+		}
+		err = errors.Join(updateErrors...)
+		if err != nil {
+			return err
+		}
+		spinner.FinalMSG = "✔️\n"
+		spinner.Stop()
+	}
+	return nil
+}
+
+// promptEndTime asks for a new end time of the entry and saves it
+func promptEndTime(entry tmetric.TimeEntry, tmetricUser tmetric.User, config *config.Config) error {
+	start, err := time.Parse("2006-01-02T15:04:05", entry.StartTime)
+	if err != nil {
+		return fmt.Errorf("cannot change the end time, the start time cannot be read: %v", err)
+	}
+	prompt := promptui.Prompt{
+		Label:   "New end time (YYYY-MM-DDTHH:MM:SS)",
+		Default: entry.EndTime,
+		Validate: func(input string) error {
+			end, err := time.Parse("2006-01-02T15:04:05", input)
+			if err != nil {
+				return errors.New("not in the format YYYY-MM-DDTHH:MM:SS")
+			}
+			if !end.After(start) {
+				return errors.New("the end time has to be after the start time " + entry.StartTime)
+			}
+			return nil
+		},
+	}
+	endTime, err := prompt.Run()
+	if err != nil {
+		return fmt.Errorf("prompt failed: %v", err)
+	}
+	entry.EndTime = endTime
+	return entry.Update(*config, tmetricUser)
+}
+
+// fixTimes lets the user change the end time of an entry with wrong times or delete it.
+// It returns false if the user skipped the entry
+func fixTimes(entry tmetric.TimeEntry, tmetricUser tmetric.User, config *config.Config) (bool, error) {
+	const changeItem = "change the end time"
+	const deleteItem = "delete the entry"
+	promptSelect := promptui.Select{
+		Label: "Fix the entry",
+		Items: []string{changeItem, deleteItem, "skip"},
+	}
+	_, action, err := promptSelect.Run()
+	if err != nil {
+		return false, fmt.Errorf("prompt failed: %v", err)
+	}
+	switch action {
+	case changeItem:
+		return true, promptEndTime(entry, tmetricUser, config)
+	case deleteItem:
+		return true, entry.Delete(*config, tmetricUser)
+	}
+	fmt.Println("skipping")
+	return false, nil
+}
+
+// fixEmptyNote asks for the note of an entry without one. It returns false if the user skipped the entry
+func fixEmptyNote(entry tmetric.TimeEntry, tmetricUser tmetric.User, config *config.Config) (bool, error) {
+	prompt := promptui.Prompt{Label: "Note (Enter to skip)"}
+	note, err := prompt.Run()
+	if err != nil {
+		return false, fmt.Errorf("prompt failed: %v", err)
+	}
+	if strings.TrimSpace(note) == "" {
+		fmt.Println("skipping")
+		return false, nil
+	}
+	entry.Note = strings.TrimSpace(note)
+	return true, entry.Update(*config, tmetricUser)
+}
+
+// fixDisallowedWorkType lets the user replace the work type of the entry. It returns false if the user skipped the entry
+func fixDisallowedWorkType(entry tmetric.TimeEntry, tmetricUser tmetric.User, config *config.Config) (bool, error) {
+	possibleWorkTypes, err := entry.GetPossibleWorkTypes(*config, tmetricUser)
+	if err != nil {
+		return false, err
+	}
+	var promptItems []string
+	for _, workType := range possibleWorkTypes {
+		promptItems = append(promptItems, workType.Name)
+	}
+	promptItems = append(promptItems, "skip")
+	promptSelectWorkType := promptui.Select{Label: "Select another work-type", Items: promptItems}
+	index, workType, err := promptSelectWorkType.Run()
+	if err != nil {
+		return false, fmt.Errorf("prompt failed: %v", err)
+	}
+	if index == len(possibleWorkTypes) {
+		fmt.Println("skipping")
+		return false, nil
+	}
+	var tags []tmetric.Tag
+	for _, tag := range entry.Tags {
+		if !tag.IsWorkType {
+			tags = append(tags, tag)
+		}
+	}
+	entry.Tags = append(tags, tmetric.Tag{Name: workType, IsWorkType: true})
+	return true, entry.Update(*config, tmetricUser)
+}
+
+// handleProblems shows the problems the validators found and offers a fix where there is one
+func handleProblems(problems []tmetric.Problem, tmetricUser tmetric.User, config *config.Config) error {
+	if len(problems) > 0 {
+		fmt.Println("Some time-entries have other problems")
+	}
+	// an entry that was changed has a new id, so the further problems of it cannot be fixed in this run
+	changedEntries := map[int]bool{}
+	for _, problem := range problems {
+		fmt.Printf("%v: %v: %v\n", problem.Severity, describeEntry(problem.Entry), problem.Message)
+		if changedEntries[problem.Entry.Id] {
+			fmt.Println("the entry was changed already, run the check again to fix this")
+			continue
+		}
+		// an entry that could not be checked has nothing to fix yet
+		if problem.CheckFailed {
+			continue
+		}
+		var changed bool
+		var err error
+		switch problem.Validator {
+		case tmetric.ValidatorEndBeforeStart, tmetric.ValidatorDuration, tmetric.ValidatorMidnight:
+			changed, err = fixTimes(problem.Entry, tmetricUser, config)
+		case tmetric.ValidatorEmptyNote:
+			changed, err = fixEmptyNote(problem.Entry, tmetricUser, config)
+		case tmetric.ValidatorDisallowedWorkType:
+			changed, err = fixDisallowedWorkType(problem.Entry, tmetricUser, config)
+		default:
+			// running timers and overlaps are only reported, the fix needs a look at the whole day in tmetric
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if changed {
+			changedEntries[problem.Entry.Id] = true
+		}
+	}
+	return nil
+}
+
 var tmetricCmd = &cobra.Command{
 	Use:   "tmetric",
 	Short: "check the validity of the tmetric data",
-	Long:  ``,
+	Long: `Finds time entries without a work package or a work type and fixes them.
+It also finds running timers, entries with wrong times, without a note, that overlap or span midnight,
+and work types the work package does not allow.
+The rules of the rules file are applied first, then the remaining entries are fixed interactively.
+With --non-interactive only the rules are applied, e.g. to run the check in cron or CI.
+With --batch the entries are grouped, e.g. by their note, and every group is fixed with a single answer.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		_, err := time.Parse("2006-01-02", startDate)
 		if err != nil {
@@ -189,22 +685,67 @@ var tmetricCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("end date is not in the format YYYY-MM-DD")
 		}
+		if !slices.Contains(tmetric.GroupByOptions, tmetric.GroupBy(groupBy)) {
+			return fmt.Errorf("--group-by has to be one of %v", tmetric.GroupByOptions)
+		}
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		config := config.NewConfig()
+		config, err := loadProfile(profileName)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
 
-		tmetricUser := tmetric.NewUser()
+		if rulesFile == "" {
+			rulesFile = config.RulesFile
+		}
+		var checkRules *rules.Rules
+		if rulesFile != "" {
+			checkRules, err = rules.Load(rulesFile)
+			if err != nil {
+				_, _ = fmt.Fprint(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		tmetricUser, err := tmetric.NewUser(config)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		// dummy entries of an earlier run that was interrupted would be counted as work
+		linker := tmetric.NewLinker(config, tmetricUser)
+		deletedDummyEntries, err := linker.CleanUpDummyEntries()
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		if deletedDummyEntries > 0 {
+			fmt.Printf("deleted %v left over dummy time entries in tmetric\n", deletedDummyEntries)
+		}
 		timeEntries, err := tmetric.GetAllTimeEntries(config, tmetricUser, startDate, endDate)
 		if err != nil {
 			_, _ = fmt.Fprint(os.Stderr, err)
 			os.Exit(1)
 		}
-		err = handleEntriesWithoutIssue(timeEntries, tmetricUser, config)
+		linker.RememberTasks(timeEntries)
+		unresolvedWithoutIssue, err := applyWorkPackageRules(timeEntries, checkRules, linker, config)
 		if err != nil {
 			_, _ = fmt.Fprint(os.Stderr, err)
 			os.Exit(1)
 		}
+		if !nonInteractive {
+			if batch {
+				err = handleGroupsWithoutIssue(entriesOf(unresolvedWithoutIssue), linker, config)
+			} else {
+				err = handleEntriesWithoutIssue(entriesOf(unresolvedWithoutIssue), linker, config)
+			}
+			if err != nil {
+				_, _ = fmt.Fprint(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
 
 		// after and update time entries receive a new id, so we need to fetch them again
 		timeEntries, err = tmetric.GetAllTimeEntries(config, tmetricUser, startDate, endDate)
@@ -212,11 +753,59 @@ var tmetricCmd = &cobra.Command{
 			_, _ = fmt.Fprint(os.Stderr, err)
 			os.Exit(1)
 		}
-		err = handleEntriesWithoutWorkType(timeEntries, tmetricUser, config)
+		unresolvedWithoutWorkType, err := applyWorkTypeRules(timeEntries, checkRules, tmetricUser, config)
 		if err != nil {
 			_, _ = fmt.Fprint(os.Stderr, err)
 			os.Exit(1)
 		}
+		if !nonInteractive {
+			if batch {
+				err = handleGroupsWithoutWorkType(entriesOf(unresolvedWithoutWorkType), tmetricUser, config)
+			} else {
+				err = handleEntriesWithoutWorkType(entriesOf(unresolvedWithoutWorkType), tmetricUser, config)
+			}
+			if err != nil {
+				_, _ = fmt.Fprint(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		// the rules and the answers changed the entries, so the other problems are searched in fresh data
+		timeEntries, err = tmetric.GetAllTimeEntries(config, tmetricUser, startDate, endDate)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		problems, err := tmetric.Validate(
+			timeEntries, tmetric.DefaultValidators(config, openproject.NewActivityCache()),
+		)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !nonInteractive {
+			err = handleProblems(problems, tmetricUser, config)
+			if err != nil {
+				_, _ = fmt.Fprint(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		unresolved := append(unresolvedWithoutIssue, unresolvedWithoutWorkType...)
+		for _, problem := range problems {
+			// warnings might be intended, so they don't let the check fail
+			if problem.Severity == tmetric.SeverityWarning {
+				fmt.Printf("warning: %v: %v\n", describeEntry(problem.Entry), problem.Message)
+				continue
+			}
+			unresolved = append(unresolved, unresolvedEntry{entry: problem.Entry, problem: problem.Message})
+		}
+		if len(unresolved) > 0 {
+			printUnresolvedEntries(unresolved)
+			os.Exit(1)
+		}
+		fmt.Println("all time entries are fine")
 	},
 }
 
@@ -238,4 +827,19 @@ func init() {
 	tmetricCmd.Flags().StringVarP(&startDate, "start", "s", firstDayOfMonth, "start date")
 	today := time.Now().Format("2006-01-02")
 	tmetricCmd.Flags().StringVarP(&endDate, "end", "e", today, "end date")
+	tmetricCmd.Flags().StringVar(
+		&rulesFile, "rules", "", "file with rules to fix the time entries without asking (default is 'rulesFile' of the config)",
+	)
+	tmetricCmd.Flags().BoolVar(
+		&nonInteractive,
+		"non-interactive",
+		false,
+		"only apply the rules, report the entries that are still not fixed and exit with an error if there are any",
+	)
+	tmetricCmd.Flags().BoolVar(
+		&batch, "batch", false, "ask once for every group of entries instead of every single entry",
+	)
+	tmetricCmd.Flags().StringVar(
+		&groupBy, "group-by", string(tmetric.GroupByNote), "how to group the entries in batch mode: note, project or task",
+	)
 }
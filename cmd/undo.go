@@ -0,0 +1,196 @@
+/*
+Copyright © 2024 JankariTech Pvt. Ltd. info@jankaritech.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/state"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+)
+
+var runIdToUndo string
+
+// undoTransfer deletes the OpenProject entry of the transfer
+// and removes the tag from the tmetric entry it was created from, if it still exists
+func undoTransfer(
+	transfer state.Transfer,
+	tmetricTimeEntries []tmetric.TimeEntry,
+	tmetricUser tmetric.User,
+	transfers *state.Store,
+	config *config.Config,
+) error {
+	err := openproject.DeleteTimeEntry(*config, transfer.OpenProjectEntryId)
+	// an entry that someone deleted in OpenProject already only has to be untagged and forgotten
+	if err != nil && !errors.Is(err, openproject.ErrTimeEntryNotFound) {
+		return err
+	}
+
+	tmetricTimeEntry, _, found := findEntryOfTransfer(transfer, tmetricTimeEntries, transfers)
+	if found {
+		tmetricTimeEntry.RemoveTagTransferredToOpenProject(*config)
+		err = tmetricTimeEntry.Update(*config, tmetricUser)
+		if err != nil {
+			return fmt.Errorf(
+				"OpenProject entry %v was deleted, but the tag could not be removed from the tmetric entry\n"+
+					"Error: %v\n",
+				transfer.OpenProjectEntryId,
+				err,
+			)
+		}
+	}
+	return transfers.Remove(transfer.OpenProjectEntryId)
+}
+
+// transfersCreatedBetween returns the transfers of time spent between the dates that were created by a copy run.
+// Transfers without a run linked an entry that existed in OpenProject already, so undoing must not delete it
+func transfersCreatedBetween(transfers *state.Store, startDate string, endDate string) []state.Transfer {
+	var createdTransfers []state.Transfer
+	for _, transfer := range transfers.TransfersSpentBetween(startDate, endDate) {
+		if transfer.RunId != "" {
+			createdTransfers = append(createdTransfers, transfer)
+		}
+	}
+	return createdTransfers
+}
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "undo a copy run",
+	Long: `Deletes the time entries in OpenProject that were created by a copy run
+and removes the 'transferred-to-openproject' tag from the matching entries in tmetric.
+Select the entries either by the id of the copy run (--run) or by the date range (--start and --end).
+Without any of these flags the ids of all known runs are listed.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		_, err := time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return fmt.Errorf("start date is not in the format YYYY-MM-DD")
+		}
+		_, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return fmt.Errorf("end date is not in the format YYYY-MM-DD")
+		}
+		if runIdToUndo != "" && (cmd.Flags().Changed("start") || cmd.Flags().Changed("end")) {
+			return fmt.Errorf("use either --run or --start and --end")
+		}
+		if cmd.Flags().Changed("start") != cmd.Flags().Changed("end") {
+			return fmt.Errorf("both --start and --end are required to undo the entries of a date range")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadProfile(profileName)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		transfers, err := state.Load(config.StateFile)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		var transfersToUndo []state.Transfer
+		switch {
+		case runIdToUndo != "":
+			transfersToUndo = transfers.TransfersOfRun(runIdToUndo)
+		case cmd.Flags().Changed("start") && cmd.Flags().Changed("end"):
+			transfersToUndo = transfersCreatedBetween(transfers, startDate, endDate)
+		default:
+			fmt.Println("please supply a run id (--run) or a date range (--start and --end). Known runs:")
+			for _, runId := range transfers.RunIds() {
+				fmt.Printf("%v (%v entries)\n", runId, len(transfers.TransfersOfRun(runId)))
+			}
+			return
+		}
+		if len(transfersToUndo) == 0 {
+			fmt.Println("no transferred entries found")
+			return
+		}
+
+		// the tmetric entries have to be looked up for the whole time span of the selected transfers
+		firstDay, lastDay := transfersToUndo[0].SpentOn, transfersToUndo[0].SpentOn
+		for _, transfer := range transfersToUndo {
+			if transfer.SpentOn < firstDay {
+				firstDay = transfer.SpentOn
+			}
+			if transfer.SpentOn > lastDay {
+				lastDay = transfer.SpentOn
+			}
+		}
+		tmetricUser, err := tmetric.NewUser(config)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+		tmetricTimeEntries, err := tmetric.GetAllTimeEntries(config, tmetricUser, firstDay, lastDay)
+		if err != nil {
+			_, _ = fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		prompt := promptui.Prompt{
+			Label: fmt.Sprintf(
+				"Delete %v time entries spent between %v and %v from OpenProject and untag them in tmetric",
+				len(transfersToUndo), firstDay, lastDay,
+			),
+			IsConfirm: true,
+		}
+		undoConfirmation, _ := prompt.Run()
+		if strings.ToLower(undoConfirmation) != "y" {
+			return
+		}
+
+		for _, transfer := range transfersToUndo {
+			spinner := newSpinner()
+			spinner.Prefix = fmt.Sprintf(
+				"Undoing transfer of OpenProject entry %v spent on %v ", transfer.OpenProjectEntryId, transfer.SpentOn,
+			)
+			spinner.FinalMSG = "❌\n"
+			spinner.Start()
+			err = undoTransfer(transfer, tmetricTimeEntries, tmetricUser, transfers, config)
+			if err != nil {
+				spinner.Stop()
+				_, _ = fmt.Fprint(os.Stderr, err)
+				os.Exit(1)
+			}
+			spinner.FinalMSG = "✔️\n"
+			spinner.Stop()
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+
+	firstDayOfMonth := time.Now().AddDate(0, 0, -time.Now().Day()+1).Format("2006-01-02")
+
+	undoCmd.Flags().StringVarP(&startDate, "start", "s", firstDayOfMonth, "start date")
+	today := time.Now().Format("2006-01-02")
+	undoCmd.Flags().StringVarP(&endDate, "end", "e", today, "end date")
+	undoCmd.Flags().StringVarP(&runIdToUndo, "run", "r", "", "id of the copy run to undo")
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/state"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUndoTransfer_entryDeletedInOpenProject(t *testing.T) {
+	var updatedEntry tmetric.TimeEntry
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v3/time_entries/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			_ = json.NewDecoder(r.Body).Decode(&updatedEntry)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer mockServer.Close()
+	config := config.Config{
+		OpenProjectUrl:                     mockServer.URL,
+		OpenProjectToken:                   "dummyToken",
+		TmetricToken:                       "dummyToken",
+		TmetricAPIV3BaseUrl:                mockServer.URL + "/v3/",
+		TmetricTagTransferredToOpenProject: "transferred-to-openproject",
+	}
+	transfers, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	transfer := state.Transfer{RunId: "run", TmetricEntryId: 1, OpenProjectEntryId: 10, SpentOn: "2024-05-10"}
+	assert.NoError(t, transfers.Record(transfer))
+	tmetricTimeEntries := []tmetric.TimeEntry{
+		{Id: 1, Note: "coding", Tags: []tmetric.Tag{{Name: "transferred-to-openproject"}}},
+	}
+
+	err = undoTransfer(transfer, tmetricTimeEntries, tmetric.User{ActiveAccountId: 2}, transfers, &config)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updatedEntry.Id)
+	assert.Empty(t, updatedEntry.Tags)
+	assert.Empty(t, transfers.Transfers)
+}
+
+func TestTransfersCreatedBetween(t *testing.T) {
+	transfers, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	createdTransfer := state.Transfer{RunId: "run", TmetricEntryId: 1, OpenProjectEntryId: 10, SpentOn: "2024-05-10"}
+	assert.NoError(t, transfers.Record(createdTransfer))
+	// the entry existed in OpenProject already and was only linked
+	assert.NoError(t, transfers.Record(state.Transfer{TmetricEntryId: 2, OpenProjectEntryId: 20, SpentOn: "2024-05-10"}))
+	assert.NoError(t, transfers.Record(state.Transfer{
+		RunId: "run", TmetricEntryId: 3, OpenProjectEntryId: 30, SpentOn: "2024-06-01",
+	}))
+
+	assert.Equal(t, []state.Transfer{createdTransfer}, transfersCreatedBetween(transfers, "2024-05-01", "2024-05-31"))
+}
+
+func TestUndoCmd_PreRunE(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "run id", args: []string{"--run", "20240510T090000Z"}},
+		{name: "date range", args: []string{"--start", "2024-05-01", "--end", "2024-05-31"}},
+		{name: "no flags"},
+		{name: "only start", args: []string{"--start", "2024-05-01"}, wantErr: "both --start and --end are required"},
+		{name: "only end", args: []string{"--end", "2024-05-31"}, wantErr: "both --start and --end are required"},
+		{
+			name:    "run id and date",
+			args:    []string{"--run", "20240510T090000Z", "--start", "2024-05-01"},
+			wantErr: "use either --run or --start and --end",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalStart, originalEnd, originalRunId := startDate, endDate, runIdToUndo
+			t.Cleanup(func() {
+				startDate, endDate, runIdToUndo = originalStart, originalEnd, originalRunId
+				for _, name := range []string{"start", "end", "run"} {
+					undoCmd.Flags().Lookup(name).Changed = false
+				}
+			})
+			assert.NoError(t, undoCmd.ParseFlags(tt.args))
+
+			err := undoCmd.PreRunE(undoCmd, nil)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -18,60 +18,354 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package config
 
 import (
+	"errors"
 	"fmt"
 	"github.com/spf13/viper"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
+// ActivityMappingRule maps a tmetric work type to an OpenProject activity
+type ActivityMappingRule struct {
+	// WorkType is the name of the work type, or a regular expression that has to match the whole name if Regex is set
+	WorkType string `mapstructure:"workType"`
+	Regex    bool   `mapstructure:"regex"`
+	Activity string `mapstructure:"activity"`
+}
+
+// ActivityMappingSet is a list of rules that are tried in order, and the activity to use if no rule matches
+// and there is no activity with the name of the work type
+type ActivityMappingSet struct {
+	Mapping []ActivityMappingRule `mapstructure:"mapping"`
+	Default string                `mapstructure:"default"`
+}
+
+// ActivityMapping maps the work types of tmetric to the activities of OpenProject.
+// The rules of a project are tried before the global ones
+type ActivityMapping struct {
+	ActivityMappingSet `mapstructure:",squash"`
+	CaseInsensitive    bool `mapstructure:"caseInsensitive"`
+	// Projects are the rules per OpenProject project, the key is the id or the name of the project
+	Projects map[string]ActivityMappingSet `mapstructure:"projects"`
+}
+
+// EntrySelection selects tmetric time entries by the client or the project they were tracked on
+type EntrySelection struct {
+	ClientIds []int `mapstructure:"clientIds"`
+	// Projects are the ids or the names of the tmetric projects
+	Projects []string `mapstructure:"projects"`
+}
+
+// EntryFilter selects the tmetric time entries that are synced to OpenProject.
+// An entry is selected if its client or its project is included and neither of them is excluded
+type EntryFilter struct {
+	EntrySelection `mapstructure:",squash"`
+	Exclude        EntrySelection `mapstructure:"exclude"`
+}
+
 type Config struct {
-	OpenProjectUrl                     string
-	OpenProjectToken                   string
-	TmetricToken                       string
+	Profile              string
+	OpenProjectUrl       string
+	OpenProjectToken     string
+	OpenProjectTokenFile string
+	TmetricToken         string
+	TmetricTokenFile     string
+	// CredentialHelper is a git style credential helper that stores the tokens, e.g. 'git credential-libsecret'
+	CredentialHelper                   string
 	ClientIdInTmetric                  int
 	TmetricAPIBaseUrl                  string
 	TmetricAPIV3BaseUrl                string
 	TmetricDummyProjectId              int
 	TmetricTagTransferredToOpenProject string
 	TmetricExternalTaskLink            string
+	StateFile                          string
+	HttpTimeout                        time.Duration
+	HttpRetries                        int
+	HttpProxy                          string
+	HttpDebug                          bool
+	ActivityMapping                    ActivityMapping
+	// TmetricMaxEntryDuration is the duration from which on 'check tmetric' reports an entry as too long, 0 disables it
+	TmetricMaxEntryDuration time.Duration
+	// RulesFile contains the rules that 'check tmetric' uses to fix entries without asking
+	RulesFile string
+	// EntryFilter selects the entries in addition to ClientIdInTmetric
+	EntryFilter EntryFilter
+}
+
+// ValidationError lists all the problems that were found in the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n- " + strings.Join(e.Problems, "\n- ") + "\n"
+}
+
+// Load reads the configuration from the config file and the environment and validates it.
+// If the configuration is invalid, it's returned together with a ValidationError, so that it still can be inspected
+func Load() (*Config, error) {
+	return LoadProfile("")
 }
 
-func NewConfig() *Config {
-	openProjectUrl := viper.GetString("openproject.url")
-	if openProjectUrl == "" {
-		fmt.Fprintln(os.Stderr, "openproject.url not set")
-		os.Exit(1)
+// ProfileNames returns the names of all profiles in the config file, sorted by name
+func ProfileNames() []string {
+	var names []string
+	for name := range viper.GetStringMap("profiles") {
+		names = append(names, name)
 	}
-	openProjectToken := viper.GetString("openproject.token")
-	if openProjectToken == "" {
-		fmt.Fprintln(os.Stderr, "openproject.token not set")
-		os.Exit(1)
+	sort.Strings(names)
+	return names
+}
+
+// profileSettings reads the settings of a profile. Every setting that is not set in the profile
+// is taken from the top level of the config file
+type profileSettings struct {
+	profile string
+}
+
+func (p profileSettings) key(key string) string {
+	if p.overrides(key) {
+		return "profiles." + p.profile + "." + key
 	}
-	tmetricToken := viper.GetString("tmetric.token")
-	if tmetricToken == "" {
-		fmt.Fprintln(os.Stderr, "tmetric.token not set")
-		os.Exit(1)
+	return key
+}
+
+// tokenKey returns the key of a token setting of the service. A profile that sets its own URL of the service
+// does not use the token of the top level, that token belongs to another server
+func (p profileSettings) tokenKey(key string, urlKey string) string {
+	if p.overrides(urlKey) {
+		return "profiles." + p.profile + "." + key
 	}
-	clientIdInTmetric := viper.GetInt("tmetric.clientId")
-	if clientIdInTmetric == 0 {
-		fmt.Fprintln(os.Stderr, "tmetric.clientId not set")
-		os.Exit(1)
+	return p.key(key)
+}
+
+// overrides tells if the profile sets the setting itself
+func (p profileSettings) overrides(key string) bool {
+	return p.profile != "" && viper.IsSet("profiles."+p.profile+"."+key)
+}
+
+// LoadProfile works like Load, but the settings of the profile with the given name override the top level settings.
+// An empty name loads the top level settings only
+func LoadProfile(profile string) (*Config, error) {
+	viper.SetDefault("tmetric.apiBaseUrl", "https://app.tmetric.com/api/")
+	viper.SetDefault("tmetric.apiV3BaseUrl", "https://app.tmetric.com/api/v3/")
+	viper.SetDefault("tmetric.maxEntryDuration", "10h")
+	viper.SetDefault("http.timeout", "30s")
+	viper.SetDefault("http.retries", 3)
+
+	// viper turns all keys into lower case
+	settings := profileSettings{profile: strings.ToLower(profile)}
+	// a missing profile is reported, but the top level settings are still read,
+	// so that e.g. the 'config init' command can use them as defaults for the new profile
+	profileMissing := settings.profile != "" && !viper.IsSet("profiles."+settings.profile)
+
+	openProjectUrl := viper.GetString(settings.key("openproject.url"))
+	// the link of the external tasks in tmetric has to point to the OpenProject instance that the integration
+	// in tmetric is set up for. Some tmetric accounts only recognize "https://community.openproject.org/"
+	tmetricExternalTaskLink := viper.GetString(settings.key("tmetric.externalTaskLink"))
+	if tmetricExternalTaskLink == "" {
+		tmetricExternalTaskLink = openProjectUrl
 	}
-	tmetricDummyProjectId := viper.GetInt("tmetric.dummyProjectId")
-	if clientIdInTmetric == 0 {
-		fmt.Fprintln(os.Stderr, "tmetric.dummyProjectId not set")
-		os.Exit(1)
+	stateFile := viper.GetString(settings.key("state.file"))
+	if stateFile == "" {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			// every profile gets its own state file, the ids of the entries are only unique in one OpenProject
+			if settings.profile == "" {
+				stateFile = filepath.Join(home, ".OpenProjectTmetricIntegration.state.json")
+			} else {
+				stateFile = filepath.Join(home, ".OpenProjectTmetricIntegration."+settings.profile+".state.json")
+			}
+		}
 	}
-	return &Config{
+	config := &Config{
+		Profile:                            profile,
 		OpenProjectUrl:                     openProjectUrl,
-		OpenProjectToken:                   openProjectToken,
-		TmetricToken:                       tmetricToken,
-		ClientIdInTmetric:                  clientIdInTmetric,
-		TmetricAPIBaseUrl:                  "https://app.tmetric.com/api/",
-		TmetricAPIV3BaseUrl:                "https://app.tmetric.com/api/v3/",
-		TmetricDummyProjectId:              tmetricDummyProjectId,
+		OpenProjectToken:                   viper.GetString(settings.tokenKey("openproject.token", "openproject.url")),
+		TmetricToken:                       viper.GetString(settings.tokenKey("tmetric.token", "tmetric.apiBaseUrl")),
+		TmetricTokenFile:                   viper.GetString(settings.tokenKey("tmetric.tokenFile", "tmetric.apiBaseUrl")),
+		OpenProjectTokenFile:               viper.GetString(settings.tokenKey("openproject.tokenFile", "openproject.url")),
+		CredentialHelper:                   viper.GetString(settings.key("credentialHelper")),
+		ClientIdInTmetric:                  viper.GetInt(settings.key("tmetric.clientId")),
+		TmetricAPIBaseUrl:                  withTrailingSlash(viper.GetString(settings.key("tmetric.apiBaseUrl"))),
+		TmetricAPIV3BaseUrl:                withTrailingSlash(viper.GetString(settings.key("tmetric.apiV3BaseUrl"))),
+		TmetricDummyProjectId:              viper.GetInt(settings.key("tmetric.dummyProjectId")),
 		TmetricTagTransferredToOpenProject: "transferred-to-openproject",
-		// this value has always to be "https://community.openproject.org"
-		// otherwise tmetric does not recognize the integration and does not allow to create the external task
-		TmetricExternalTaskLink:            "https://community.openproject.org/",
+		TmetricExternalTaskLink:            withTrailingSlash(tmetricExternalTaskLink),
+		TmetricMaxEntryDuration:            viper.GetDuration(settings.key("tmetric.maxEntryDuration")),
+		StateFile:                          stateFile,
+		HttpTimeout:                        viper.GetDuration(settings.key("http.timeout")),
+		HttpRetries:                        viper.GetInt(settings.key("http.retries")),
+		HttpProxy:                          viper.GetString(settings.key("http.proxy")),
+		HttpDebug:                          viper.GetBool(settings.key("http.debug")),
+		RulesFile:                          expandHome(viper.GetString(settings.key("rulesFile"))),
+	}
+	err := viper.UnmarshalKey(settings.key("activities"), &config.ActivityMapping)
+	if err != nil {
+		return config, ValidationError{Problems: []string{fmt.Sprintf("activities cannot be read: %v", err)}}
+	}
+	err = viper.UnmarshalKey(settings.key("tmetric.filter"), &config.EntryFilter)
+	if err != nil {
+		return config, ValidationError{Problems: []string{fmt.Sprintf("tmetric.filter cannot be read: %v", err)}}
+	}
+
+	var problems []string
+	if profileMissing {
+		problems = append(problems, fmt.Sprintf("profile '%v' not found in the config file", profile))
+	}
+	// the tokens in the config file are only safe if nobody else can read it
+	if configFile := viper.ConfigFileUsed(); configFile != "" {
+		if err := checkOnlyUserCanRead(configFile, true); err != nil && !errors.Is(err, os.ErrNotExist) {
+			problems = append(problems, fmt.Sprintf("config file cannot be used: %v", err))
+		}
+	}
+	config.OpenProjectToken, err = resolveToken(
+		settings.profile, "openproject", config.OpenProjectUrl,
+		config.CredentialHelper, config.OpenProjectTokenFile, config.OpenProjectToken,
+	)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("openproject.token cannot be read: %v", err))
+	}
+	config.TmetricToken, err = resolveToken(
+		settings.profile, "tmetric", config.TmetricAPIBaseUrl,
+		config.CredentialHelper, config.TmetricTokenFile, config.TmetricToken,
+	)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("tmetric.token cannot be read: %v", err))
+	}
+	for _, service := range []struct{ name, urlKey, token string }{
+		{name: "openproject", urlKey: "openproject.url", token: config.OpenProjectToken},
+		{name: "tmetric", urlKey: "tmetric.apiBaseUrl", token: config.TmetricToken},
+	} {
+		if service.token == "" && settings.overrides(service.urlKey) {
+			problems = append(problems, fmt.Sprintf(
+				"%v.token missing in profile '%v', the profile sets its own %v, so the token of the top level is not used",
+				service.name, profile, service.urlKey,
+			))
+		}
+	}
+
+	var validationError ValidationError
+	if errors.As(config.Validate(), &validationError) {
+		problems = append(problems, validationError.Problems...)
+	}
+	if len(problems) > 0 {
+		return config, ValidationError{Problems: problems}
+	}
+	return config, nil
+}
+
+// Validate checks all settings and returns a ValidationError that lists every problem found
+func (config *Config) Validate() error {
+	var problems []string
+	checkUrl := func(key string, value string) {
+		if value == "" {
+			problems = append(problems, key+" not set")
+			return
+		}
+		parsedUrl, err := url.Parse(value)
+		if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+			problems = append(problems, fmt.Sprintf("%v '%v' is not a valid http or https URL", key, value))
+		}
+	}
+	checkId := func(key string, value int) {
+		if value == 0 {
+			problems = append(problems, key+" not set")
+		} else if value < 0 {
+			problems = append(problems, fmt.Sprintf("%v has to be a positive number, but is %v", key, value))
+		}
+	}
+
+	checkUrl("openproject.url", config.OpenProjectUrl)
+	if config.OpenProjectToken == "" {
+		problems = append(problems, "openproject.token not set")
+	}
+	if config.TmetricToken == "" {
+		problems = append(problems, "tmetric.token not set")
+	}
+	// the client is not needed if the entries are selected by the filter
+	if config.ClientIdInTmetric != 0 ||
+		(len(config.EntryFilter.ClientIds) == 0 && len(config.EntryFilter.Projects) == 0) {
+		checkId("tmetric.clientId", config.ClientIdInTmetric)
+	}
+	checkEntrySelection := func(key string, selection EntrySelection) {
+		for i, clientId := range selection.ClientIds {
+			checkId(fmt.Sprintf("%v.clientIds[%v]", key, i), clientId)
+		}
+		for i, project := range selection.Projects {
+			if strings.TrimSpace(project) == "" {
+				problems = append(problems, fmt.Sprintf("%v.projects[%v] not set", key, i))
+			}
+		}
+	}
+	checkEntrySelection("tmetric.filter", config.EntryFilter.EntrySelection)
+	checkEntrySelection("tmetric.filter.exclude", config.EntryFilter.Exclude)
+	checkId("tmetric.dummyProjectId", config.TmetricDummyProjectId)
+	checkUrl("tmetric.apiBaseUrl", config.TmetricAPIBaseUrl)
+	checkUrl("tmetric.apiV3BaseUrl", config.TmetricAPIV3BaseUrl)
+	// an empty link falls back to openproject.url, which is reported already
+	if config.TmetricExternalTaskLink != "" {
+		checkUrl("tmetric.externalTaskLink", config.TmetricExternalTaskLink)
+	}
+	if config.TmetricMaxEntryDuration < 0 {
+		problems = append(problems, fmt.Sprintf(
+			"tmetric.maxEntryDuration cannot be negative, but is %v", config.TmetricMaxEntryDuration,
+		))
+	}
+	if config.StateFile == "" {
+		problems = append(problems, "state.file not set and home folder not found")
+	}
+	if config.HttpTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("http.timeout cannot be negative, but is %v", config.HttpTimeout))
+	}
+	if config.HttpRetries < 0 {
+		problems = append(problems, fmt.Sprintf("http.retries cannot be negative, but is %v", config.HttpRetries))
+	}
+	if config.HttpProxy != "" {
+		checkUrl("http.proxy", config.HttpProxy)
+	}
+	checkActivityMappingSet := func(key string, mappingSet ActivityMappingSet) {
+		for i, rule := range mappingSet.Mapping {
+			ruleKey := fmt.Sprintf("%v.mapping[%v]", key, i)
+			if rule.WorkType == "" {
+				problems = append(problems, ruleKey+".workType not set")
+			} else if rule.Regex {
+				if _, err := regexp.Compile(rule.WorkType); err != nil {
+					problems = append(problems, fmt.Sprintf(
+						"%v.workType '%v' is not a valid regular expression: %v", ruleKey, rule.WorkType, err,
+					))
+				}
+			}
+			if rule.Activity == "" {
+				problems = append(problems, ruleKey+".activity not set")
+			}
+		}
+	}
+	checkActivityMappingSet("activities", config.ActivityMapping.ActivityMappingSet)
+	projects := make([]string, 0, len(config.ActivityMapping.Projects))
+	for project := range config.ActivityMapping.Projects {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+	for _, project := range projects {
+		checkActivityMappingSet("activities.projects."+project, config.ActivityMapping.Projects[project])
+	}
+
+	if len(problems) > 0 {
+		return ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// withTrailingSlash makes sure the URL ends with exactly one slash, so that paths can be appended to it
+func withTrailingSlash(link string) string {
+	if link == "" {
+		return ""
 	}
+	return strings.TrimRight(link, "/") + "/"
 }
@@ -0,0 +1,356 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func validConfig() Config {
+	return Config{
+		OpenProjectUrl:          "https://openproject.example.com",
+		OpenProjectToken:        "openProjectToken",
+		TmetricToken:            "tmetricToken",
+		ClientIdInTmetric:       123,
+		TmetricAPIBaseUrl:       "https://app.tmetric.com/api/",
+		TmetricAPIV3BaseUrl:     "https://app.tmetric.com/api/v3/",
+		TmetricDummyProjectId:   456,
+		TmetricExternalTaskLink: "https://openproject.example.com/",
+		StateFile:               "/tmp/state.json",
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(config *Config)
+		wantProblems []string
+	}{
+		{
+			name:   "valid config",
+			modify: func(config *Config) {},
+		},
+		{
+			name: "missing values are all reported",
+			modify: func(config *Config) {
+				config.OpenProjectUrl = ""
+				config.OpenProjectToken = ""
+				config.TmetricToken = ""
+				config.ClientIdInTmetric = 0
+				config.TmetricDummyProjectId = 0
+				config.TmetricExternalTaskLink = ""
+				config.StateFile = ""
+			},
+			wantProblems: []string{
+				"openproject.url not set",
+				"openproject.token not set",
+				"tmetric.token not set",
+				"tmetric.clientId not set",
+				"tmetric.dummyProjectId not set",
+				"state.file not set and home folder not found",
+			},
+		},
+		{
+			name: "invalid URLs",
+			modify: func(config *Config) {
+				config.OpenProjectUrl = "openproject.example.com"
+				config.TmetricAPIBaseUrl = "ftp://app.tmetric.com/api/"
+				config.TmetricExternalTaskLink = "/"
+				config.HttpProxy = "http://"
+			},
+			wantProblems: []string{
+				"openproject.url 'openproject.example.com' is not a valid http or https URL",
+				"tmetric.apiBaseUrl 'ftp://app.tmetric.com/api/' is not a valid http or https URL",
+				"tmetric.externalTaskLink '/' is not a valid http or https URL",
+				"http.proxy 'http://' is not a valid http or https URL",
+			},
+		},
+		{
+			name: "invalid activity mapping",
+			modify: func(config *Config) {
+				config.ActivityMapping = ActivityMapping{
+					ActivityMappingSet: ActivityMappingSet{
+						Mapping: []ActivityMappingRule{
+							{WorkType: "Coding", Activity: "Development"},
+							{WorkType: "Meeting(", Regex: true, Activity: "Communication"},
+						},
+					},
+					Projects: map[string]ActivityMappingSet{
+						"my project": {Mapping: []ActivityMappingRule{{Activity: "Development"}}},
+						"12":         {Mapping: []ActivityMappingRule{{WorkType: "Coding"}}},
+					},
+				}
+			},
+			wantProblems: []string{
+				"activities.mapping[1].workType 'Meeting(' is not a valid regular expression: " +
+					"error parsing regexp: missing closing ): `Meeting(`",
+				"activities.projects.12.mapping[0].activity not set",
+				"activities.projects.my project.mapping[0].workType not set",
+			},
+		},
+		{
+			name: "negative numbers",
+			modify: func(config *Config) {
+				config.ClientIdInTmetric = -1
+				config.TmetricDummyProjectId = -2
+				config.TmetricMaxEntryDuration = -time.Hour
+				config.HttpTimeout = -time.Second
+				config.HttpRetries = -3
+			},
+			wantProblems: []string{
+				"tmetric.clientId has to be a positive number, but is -1",
+				"tmetric.dummyProjectId has to be a positive number, but is -2",
+				"tmetric.maxEntryDuration cannot be negative, but is -1h0m0s",
+				"http.timeout cannot be negative, but is -1s",
+				"http.retries cannot be negative, but is -3",
+			},
+		},
+		{
+			name: "client selected by the filter only",
+			modify: func(config *Config) {
+				config.ClientIdInTmetric = 0
+				config.EntryFilter = EntryFilter{EntrySelection: EntrySelection{Projects: []string{"Website"}}}
+			},
+		},
+		{
+			name: "invalid filter",
+			modify: func(config *Config) {
+				config.EntryFilter = EntryFilter{
+					EntrySelection: EntrySelection{ClientIds: []int{1, -2}},
+					Exclude:        EntrySelection{Projects: []string{"Internal", " "}},
+				}
+			},
+			wantProblems: []string{
+				"tmetric.filter.clientIds[1] has to be a positive number, but is -2",
+				"tmetric.filter.exclude.projects[1] not set",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.modify(&config)
+			err := config.Validate()
+			if tt.wantProblems == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationError ValidationError
+			assert.ErrorAs(t, err, &validationError)
+			assert.Equal(t, tt.wantProblems, validationError.Problems)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Reset()
+	viper.Set("openproject.url", "https://openproject.example.com")
+	viper.Set("openproject.token", "openProjectToken")
+	viper.Set("tmetric.token", "tmetricToken")
+	viper.Set("tmetric.clientId", 123)
+	viper.Set("tmetric.dummyProjectId", 456)
+	viper.Set("tmetric.apiBaseUrl", "http://localhost:8080/api")
+	viper.Set("state.file", "/tmp/state.json")
+	config, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/api/", config.TmetricAPIBaseUrl)
+	assert.Equal(t, "https://app.tmetric.com/api/v3/", config.TmetricAPIV3BaseUrl)
+	assert.Equal(t, "https://openproject.example.com/", config.TmetricExternalTaskLink)
+	assert.Equal(t, 10*time.Hour, config.TmetricMaxEntryDuration)
+	assert.Equal(t, 30*time.Second, config.HttpTimeout)
+	assert.Equal(t, 3, config.HttpRetries)
+
+	assert.Equal(t, ActivityMapping{}, config.ActivityMapping)
+	assert.Equal(t, EntryFilter{}, config.EntryFilter)
+
+	viper.Set("tmetric.filter", map[string]any{
+		"clientIds": []any{1, 2},
+		"projects":  []any{12, "Website"},
+		"exclude":   map[string]any{"projects": []any{"Internal"}},
+	})
+	config, err = Load()
+	assert.NoError(t, err)
+	assert.Equal(t, EntryFilter{
+		EntrySelection: EntrySelection{ClientIds: []int{1, 2}, Projects: []string{"12", "Website"}},
+		Exclude:        EntrySelection{Projects: []string{"Internal"}},
+	}, config.EntryFilter)
+
+	viper.Set("activities", map[string]any{
+		"caseInsensitive": true,
+		"default":         "Development",
+		"mapping": []any{
+			map[string]any{"workType": "Meeting.*", "regex": true, "activity": "Communication"},
+		},
+		"projects": map[string]any{
+			"12": map[string]any{
+				"default": "Management",
+				"mapping": []any{map[string]any{"workType": "Coding", "activity": "Specification"}},
+			},
+		},
+	})
+	config, err = Load()
+	assert.NoError(t, err)
+	assert.Equal(t, ActivityMapping{
+		ActivityMappingSet: ActivityMappingSet{
+			Mapping: []ActivityMappingRule{{WorkType: "Meeting.*", Regex: true, Activity: "Communication"}},
+			Default: "Development",
+		},
+		CaseInsensitive: true,
+		Projects: map[string]ActivityMappingSet{
+			"12": {
+				Mapping: []ActivityMappingRule{{WorkType: "Coding", Activity: "Specification"}},
+				Default: "Management",
+			},
+		},
+	}, config.ActivityMapping)
+
+	// the dummy project id was not checked before
+	viper.Set("tmetric.dummyProjectId", 0)
+	viper.Set("tmetric.externalTaskLink", "https://community.openproject.org//")
+	config, err = Load()
+	assert.EqualError(t, err, "invalid configuration:\n- tmetric.dummyProjectId not set\n")
+	assert.Equal(t, "https://community.openproject.org/", config.TmetricExternalTaskLink)
+
+	tests := []struct {
+		name string
+		// tmetricSettings are added to the tmetric section of the config file
+		tmetricSettings      string
+		env                  map[string]string
+		wantAPIBaseUrl       string
+		wantAPIV3BaseUrl     string
+		wantExternalTaskLink string
+	}{
+		{
+			name:                 "defaults",
+			wantAPIBaseUrl:       "https://app.tmetric.com/api/",
+			wantAPIV3BaseUrl:     "https://app.tmetric.com/api/v3/",
+			wantExternalTaskLink: "https://openproject.example.com/",
+		},
+		{
+			name: "set in the config file",
+			tmetricSettings: "  apiBaseUrl: http://localhost:8080/api\n" +
+				"  apiV3BaseUrl: http://localhost:8080/api/v3//\n" +
+				"  externalTaskLink: https://community.openproject.org\n",
+			wantAPIBaseUrl:       "http://localhost:8080/api/",
+			wantAPIV3BaseUrl:     "http://localhost:8080/api/v3/",
+			wantExternalTaskLink: "https://community.openproject.org/",
+		},
+		{
+			name:            "environment variables override the config file",
+			tmetricSettings: "  apiBaseUrl: http://localhost:8080/api/\n",
+			env: map[string]string{
+				"TMETRIC_APIBASEURL":       "http://mock:9000/api",
+				"TMETRIC_APIV3BASEURL":     "http://mock:9000/api/v3",
+				"TMETRIC_EXTERNALTASKLINK": "https://community.openproject.org",
+			},
+			wantAPIBaseUrl:       "http://mock:9000/api/",
+			wantAPIV3BaseUrl:     "http://mock:9000/api/v3/",
+			wantExternalTaskLink: "https://community.openproject.org/",
+		},
+		{
+			name:                 "external task link follows the OpenProject URL of the environment",
+			env:                  map[string]string{"OPENPROJECT_URL": "https://op.internal.example.com"},
+			wantAPIBaseUrl:       "https://app.tmetric.com/api/",
+			wantAPIV3BaseUrl:     "https://app.tmetric.com/api/v3/",
+			wantExternalTaskLink: "https://op.internal.example.com/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			// the same way as the root command reads the environment variables
+			viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+			viper.AutomaticEnv()
+			viper.SetConfigType("yaml")
+			err := viper.ReadConfig(strings.NewReader("" +
+				"openproject:\n" +
+				"  url: https://openproject.example.com\n" +
+				"  token: openProjectToken\n" +
+				"state:\n" +
+				"  file: /tmp/state.json\n" +
+				"tmetric:\n" +
+				"  token: tmetricToken\n" +
+				"  clientId: 123\n" +
+				"  dummyProjectId: 456\n" +
+				tt.tmetricSettings,
+			))
+			assert.NoError(t, err)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			config, err := Load()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAPIBaseUrl, config.TmetricAPIBaseUrl)
+			assert.Equal(t, tt.wantAPIV3BaseUrl, config.TmetricAPIV3BaseUrl)
+			assert.Equal(t, tt.wantExternalTaskLink, config.TmetricExternalTaskLink)
+		})
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Reset()
+	viper.Set("openproject.url", "https://openproject.example.com")
+	viper.Set("openproject.token", "openProjectToken")
+	viper.Set("tmetric.token", "tmetricToken")
+	viper.Set("tmetric.clientId", 123)
+	viper.Set("tmetric.dummyProjectId", 456)
+	viper.Set("profiles", map[string]any{
+		"ClientB": map[string]any{
+			"openproject": map[string]any{"url": "https://clientb.example.com", "token": "clientBToken"},
+			"tmetric":     map[string]any{"clientId": 789},
+			"activities":  map[string]any{"default": "Development"},
+		},
+		"clientA": map[string]any{
+			"tmetric": map[string]any{"dummyProjectId": 111},
+		},
+		// another OpenProject instance, but the token was forgotten
+		"clientC": map[string]any{
+			"openproject": map[string]any{"url": "https://clientc.example.com"},
+		},
+	})
+
+	assert.Equal(t, []string{"clienta", "clientb", "clientc"}, ProfileNames())
+
+	config, err := LoadProfile("clientB")
+	assert.NoError(t, err)
+	assert.Equal(t, "clientB", config.Profile)
+	assert.Equal(t, "https://clientb.example.com", config.OpenProjectUrl)
+	assert.Equal(t, "https://clientb.example.com/", config.TmetricExternalTaskLink)
+	assert.Equal(t, "clientBToken", config.OpenProjectToken)
+	assert.Equal(t, "tmetricToken", config.TmetricToken)
+	assert.Equal(t, 789, config.ClientIdInTmetric)
+	assert.Equal(t, 456, config.TmetricDummyProjectId)
+	assert.Equal(t, "Development", config.ActivityMapping.Default)
+	assert.Contains(t, config.StateFile, ".OpenProjectTmetricIntegration.clientb.state.json")
+
+	config, err = LoadProfile("clientA")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://openproject.example.com", config.OpenProjectUrl)
+	assert.Equal(t, 123, config.ClientIdInTmetric)
+	assert.Equal(t, 111, config.TmetricDummyProjectId)
+	assert.Equal(t, ActivityMapping{}, config.ActivityMapping)
+
+	// the token of the top level belongs to another server, so it must not be sent to the one of the profile
+	config, err = LoadProfile("clientC")
+	assert.EqualError(
+		t, err,
+		"invalid configuration:\n"+
+			"- openproject.token missing in profile 'clientC', the profile sets its own openproject.url, "+
+			"so the token of the top level is not used\n"+
+			"- openproject.token not set\n",
+	)
+	assert.Empty(t, config.OpenProjectToken)
+	assert.Equal(t, "tmetricToken", config.TmetricToken)
+
+	config, err = LoadProfile("unknown")
+	assert.EqualError(t, err, "invalid configuration:\n- profile 'unknown' not found in the config file\n")
+	assert.Equal(t, "https://openproject.example.com", config.OpenProjectUrl)
+}
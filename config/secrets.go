@@ -0,0 +1,230 @@
+/*
+Copyright © 2024 JankariTech Pvt. Ltd. info@jankaritech.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// TokenEnvPrefix is the prefix of the environment variables that hold the tokens, e.g. OPTI_OPENPROJECT_TOKEN,
+// or OPTI_CLIENTA_OPENPROJECT_TOKEN for the profile 'clientA'
+const TokenEnvPrefix = "OPTI_"
+
+// credentialHelperUsername is the username the tokens are stored under in the credential helper,
+// every profile gets its own, so that the profiles can use different tokens for the same service
+func credentialHelperUsername(profile string) string {
+	if profile == "" {
+		return "apikey"
+	}
+	return "apikey-" + strings.ToLower(profile)
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// tokenEnvNames returns the names of the environment variables that can hold the token of the service,
+// the one of the profile comes first
+func tokenEnvNames(profile string, service string) []string {
+	name := strings.ToUpper(service) + "_TOKEN"
+	var names []string
+	if profile != "" {
+		names = append(names, TokenEnvPrefix+strings.ToUpper(nonAlphanumeric.ReplaceAllString(profile, "_"))+"_"+name)
+	}
+	return append(names, TokenEnvPrefix+name)
+}
+
+// expandHome replaces a leading ~/ with the home folder of the user
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// checkOnlyUserCanRead returns an error if anybody else than the owner can read the file.
+// Windows does not have these permissions, so nothing is checked there
+func checkOnlyUserCanRead(path string, allowGroup bool) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	forbidden := os.FileMode(0o044)
+	if allowGroup {
+		forbidden = 0o004
+	}
+	if info.Mode().Perm()&forbidden != 0 {
+		return fmt.Errorf("'%v' can be read by other users, run 'chmod 600 %v'", path, path)
+	}
+	return nil
+}
+
+// readTokenFile reads the token from a file that only the user can read
+func readTokenFile(path string) (string, error) {
+	path = expandHome(path)
+	err := checkOnlyUserCanRead(path, false)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// writeTokenFile writes the token into a file that only the user can read
+func writeTokenFile(path string, token string) error {
+	path = expandHome(path)
+	// an existing file keeps its permissions when it's opened, so they are fixed before the token is written
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("could not write the token file '%v': %v", path, err)
+	}
+	defer file.Close()
+	if err = file.Chmod(0600); err != nil {
+		return fmt.Errorf("could not write the token file '%v': %v", path, err)
+	}
+	if _, err = file.WriteString(token + "\n"); err != nil {
+		return fmt.Errorf("could not write the token file '%v': %v", path, err)
+	}
+	return file.Close()
+}
+
+// runCredentialHelper runs a credential helper the way git does: the action is added as the last argument
+// and the credential is described on stdin, e.g. 'git credential-libsecret get'.
+// The path of the URL is passed too, so that e.g. two OpenProject instances on the same host get different tokens
+func runCredentialHelper(
+	helper string, action string, profile string, serviceUrl string, token string,
+) (string, error) {
+	args := strings.Fields(helper)
+	if len(args) == 0 {
+		return "", errors.New("no credential helper set")
+	}
+	parsedUrl, err := url.Parse(serviceUrl)
+	if err != nil || parsedUrl.Host == "" {
+		return "", fmt.Errorf("cannot use the credential helper for the URL '%v'", serviceUrl)
+	}
+	input := fmt.Sprintf("protocol=%v\nhost=%v\n", parsedUrl.Scheme, parsedUrl.Host)
+	if urlPath := strings.Trim(parsedUrl.Path, "/"); urlPath != "" {
+		input += fmt.Sprintf("path=%v\n", urlPath)
+	}
+	input += fmt.Sprintf("username=%v\n", credentialHelperUsername(profile))
+	if token != "" {
+		input += fmt.Sprintf("password=%v\n", token)
+	}
+	cmd := exec.Command(args[0], append(args[1:], action)...)
+	cmd.Stdin = strings.NewReader(input + "\n")
+	// the helper might need to ask for a password to unlock the keyring
+	cmd.Stderr = os.Stderr
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	err = cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("credential helper '%v %v' failed: %v", helper, action, err)
+	}
+	return output.String(), nil
+}
+
+// getTokenFromCredentialHelper returns the token stored for the profile and the URL,
+// or an empty string if the helper has none
+func getTokenFromCredentialHelper(helper string, profile string, serviceUrl string) (string, error) {
+	output, err := runCredentialHelper(helper, "get", profile, serviceUrl, "")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if token, found := strings.CutPrefix(line, "password="); found {
+			return strings.TrimSpace(token), nil
+		}
+	}
+	return "", nil
+}
+
+// storeTokenWithCredentialHelper stores the token for the profile and the URL with the credential helper
+func storeTokenWithCredentialHelper(helper string, profile string, serviceUrl string, token string) error {
+	_, err := runCredentialHelper(helper, "store", profile, serviceUrl, token)
+	return err
+}
+
+// resolveToken returns the token of the service from the first source that has one:
+// the environment variables with the TokenEnvPrefix, the credential helper, the token file,
+// and finally the token in the config file
+func resolveToken(
+	profile string, service string, serviceUrl string, credentialHelper string, tokenFile string, token string,
+) (string, error) {
+	for _, name := range tokenEnvNames(profile, service) {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			return value, nil
+		}
+	}
+	if credentialHelper != "" && serviceUrl != "" {
+		value, err := getTokenFromCredentialHelper(credentialHelper, profile, serviceUrl)
+		if err != nil {
+			return "", err
+		}
+		if value != "" {
+			return value, nil
+		}
+	}
+	if tokenFile != "" {
+		value, err := readTokenFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("token file cannot be used: %v", err)
+		}
+		return value, nil
+	}
+	return token, nil
+}
+
+// WriteTokenFiles writes the tokens into the token files, that only the user can read
+func (config *Config) WriteTokenFiles() error {
+	err := writeTokenFile(config.OpenProjectTokenFile, config.OpenProjectToken)
+	if err != nil {
+		return err
+	}
+	return writeTokenFile(config.TmetricTokenFile, config.TmetricToken)
+}
+
+// StoreTokensWithCredentialHelper stores the tokens with the credential helper,
+// under the URL of each service and a username of the profile
+func (config *Config) StoreTokensWithCredentialHelper() error {
+	err := storeTokenWithCredentialHelper(
+		config.CredentialHelper, config.Profile, config.OpenProjectUrl, config.OpenProjectToken,
+	)
+	if err != nil {
+		return err
+	}
+	return storeTokenWithCredentialHelper(
+		config.CredentialHelper, config.Profile, config.TmetricAPIBaseUrl, config.TmetricToken,
+	)
+}
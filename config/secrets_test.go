@@ -0,0 +1,214 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCredentialHelper creates a script that acts as a git style credential helper and logs what it was asked
+func writeCredentialHelper(t *testing.T, output string) (string, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential helper is a shell script")
+	}
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "log")
+	helper := filepath.Join(dir, "helper")
+	script := "#!/bin/sh\necho \"$1\" >> " + logFile + "\ncat >> " + logFile + "\nprintf '" + output + "'\n"
+	assert.NoError(t, os.WriteFile(helper, []byte(script), 0700))
+	return helper, logFile
+}
+
+func TestResolveToken(t *testing.T) {
+	helperWithToken, _ := writeCredentialHelper(t, "protocol=https\\nhost=op.example.com\\npassword=helperToken\\n")
+	helperWithoutToken, _ := writeCredentialHelper(t, "")
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("fileToken\n"), 0600))
+	readableTokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(readableTokenFile, []byte("fileToken\n"), 0644))
+	assert.NoError(t, os.Chmod(readableTokenFile, 0644))
+
+	tests := []struct {
+		name             string
+		env              map[string]string
+		profile          string
+		credentialHelper string
+		tokenFile        string
+		expectedToken    string
+		expectedError    string
+	}{
+		{
+			name:          "token of the config file",
+			expectedToken: "configToken",
+		},
+		{
+			name:          "environment variable wins",
+			env:           map[string]string{"OPTI_OPENPROJECT_TOKEN": "envToken"},
+			tokenFile:     tokenFile,
+			expectedToken: "envToken",
+		},
+		{
+			name: "environment variable of the profile wins",
+			env: map[string]string{
+				"OPTI_OPENPROJECT_TOKEN":          "envToken",
+				"OPTI_CLIENT_A_OPENPROJECT_TOKEN": "profileEnvToken",
+			},
+			profile:       "client-a",
+			expectedToken: "profileEnvToken",
+		},
+		{
+			name:             "credential helper",
+			credentialHelper: helperWithToken,
+			tokenFile:        tokenFile,
+			expectedToken:    "helperToken",
+		},
+		{
+			name:             "credential helper without token falls back to the token file",
+			credentialHelper: helperWithoutToken,
+			tokenFile:        tokenFile,
+			expectedToken:    "fileToken",
+		},
+		{
+			name:             "failing credential helper",
+			credentialHelper: filepath.Join(t.TempDir(), "missing"),
+			expectedError:    "credential helper",
+		},
+		{
+			name:          "token file readable by others",
+			tokenFile:     readableTokenFile,
+			expectedError: "can be read by other users",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			token, err := resolveToken(
+				tt.profile, "openproject", "https://op.example.com/", tt.credentialHelper, tt.tokenFile, "configToken",
+			)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedToken, token)
+		})
+	}
+}
+
+func Test_storeTokenWithCredentialHelper(t *testing.T) {
+	tests := []struct {
+		name          string
+		profile       string
+		serviceUrl    string
+		expectedInput string
+	}{
+		{
+			name:          "without profile",
+			serviceUrl:    "https://op.example.com/",
+			expectedInput: "protocol=https\nhost=op.example.com\nusername=apikey\npassword=secret\n\n",
+		},
+		{
+			name:          "with profile",
+			profile:       "ClientA",
+			serviceUrl:    "https://op.example.com/",
+			expectedInput: "protocol=https\nhost=op.example.com\nusername=apikey-clienta\npassword=secret\n\n",
+		},
+		{
+			name:          "with path",
+			serviceUrl:    "https://example.com/openproject/",
+			expectedInput: "protocol=https\nhost=example.com\npath=openproject\nusername=apikey\npassword=secret\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			helper, logFile := writeCredentialHelper(t, "")
+			err := storeTokenWithCredentialHelper(helper, tt.profile, tt.serviceUrl, "secret")
+			assert.NoError(t, err)
+			log, err := os.ReadFile(logFile)
+			assert.NoError(t, err)
+			assert.Equal(t, "store\n"+tt.expectedInput, string(log))
+		})
+	}
+}
+
+func Test_writeTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, writeTokenFile(tokenFile, "secret"))
+	token, err := readTokenFile(tokenFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", token)
+
+	// an existing file that others can read is overwritten completely and cannot be read by them anymore
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("a much longer old token\n"), 0644))
+	assert.NoError(t, os.Chmod(tokenFile, 0644))
+	assert.NoError(t, writeTokenFile(tokenFile, "new"))
+	token, err = readTokenFile(tokenFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", token)
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(tokenFile)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func Test_checkOnlyUserCanRead(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("there are no file permissions on windows")
+	}
+	tests := []struct {
+		name       string
+		mode       os.FileMode
+		allowGroup bool
+		wantErr    bool
+	}{
+		{name: "only the user", mode: 0600},
+		{name: "others can read", mode: 0604, wantErr: true},
+		{name: "group can read", mode: 0640, wantErr: true},
+		{name: "group can read if allowed", mode: 0640, allowGroup: true},
+		{name: "others can read although the group is allowed", mode: 0644, allowGroup: true, wantErr: true},
+		// only reading gives away the token
+		{name: "others can only write", mode: 0622},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "token")
+			assert.NoError(t, os.WriteFile(path, []byte("secret\n"), 0600))
+			assert.NoError(t, os.Chmod(path, tt.mode))
+			err := checkOnlyUserCanRead(path, tt.allowGroup)
+			if tt.wantErr {
+				assert.EqualError(t, err, "'"+path+"' can be read by other users, run 'chmod 600 "+path+"'")
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLoad_worldReadableConfigFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("there are no file permissions on windows")
+	}
+	t.Cleanup(viper.Reset)
+	viper.Reset()
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	content := "openproject:\n  url: https://op.example.com\n  token: a\n" +
+		"tmetric:\n  token: b\n  clientId: 1\n  dummyProjectId: 2\nstate:\n  file: /tmp/state.json\n"
+	assert.NoError(t, os.WriteFile(configFile, []byte(content), 0600))
+	viper.SetConfigFile(configFile)
+	assert.NoError(t, viper.ReadInConfig())
+	_, err := Load()
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Chmod(configFile, 0644))
+	_, err = Load()
+	assert.ErrorContains(t, err, "config file cannot be used: '"+configFile+"' can be read by other users")
+}
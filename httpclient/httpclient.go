@@ -0,0 +1,99 @@
+/*
+Copyright © 2024 JankariTech Pvt. Ltd. info@jankaritech.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package httpclient builds the HTTP clients that are used to talk to the APIs of tmetric and OpenProject
+package httpclient
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/go-resty/resty/v2"
+)
+
+const userAgent = "OpenProjectTmetricIntegration"
+
+// retryWaitTime is the wait time before the first retry, it doubles with every further retry
+// and is capped by retryMaxWaitTime, also when the server asks to wait longer
+var retryWaitTime = time.Second
+var retryMaxWaitTime = time.Minute
+
+// New returns a client that uses the timeout, retries, proxy and debug settings of the configuration.
+// Authentication has to be set by the caller, because every backend does it differently
+func New(config config.Config) *resty.Client {
+	httpClient := resty.New().
+		SetHeader("User-Agent", userAgent).
+		SetTimeout(config.HttpTimeout).
+		SetRetryCount(config.HttpRetries).
+		SetRetryWaitTime(retryWaitTime).
+		SetRetryMaxWaitTime(retryMaxWaitTime).
+		SetRetryAfter(retryAfter).
+		AddRetryCondition(shouldRetry)
+	if config.HttpProxy != "" {
+		httpClient.SetProxy(config.HttpProxy)
+	}
+	if config.HttpDebug {
+		httpClient.SetDebug(true).OnRequestLog(redactRequestLog)
+	}
+	return httpClient
+}
+
+// shouldRetry retries requests that were rate limited, and requests that failed because of the network
+// or a server error. POST requests are only retried when rate limited, because in any other case they
+// might have been processed already and retrying would create the data a second time
+func shouldRetry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+	if resp.StatusCode() == http.StatusTooManyRequests {
+		return true
+	}
+	if resp.Request.Method == http.MethodPost {
+		return false
+	}
+	return err != nil || resp.StatusCode() >= http.StatusInternalServerError
+}
+
+// retryAfter returns the wait time the server asked for in the Retry-After header,
+// 0 means that the exponential backoff is used
+func retryAfter(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+	if resp == nil {
+		return 0, nil
+	}
+	header := resp.Header().Get("Retry-After")
+	if header == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	// a date that has passed already, e.g. because the clocks differ, must not be taken as the longest wait time
+	if date, err := http.ParseTime(header); err == nil && time.Until(date) > 0 {
+		return time.Until(date), nil
+	}
+	return 0, nil
+}
+
+// redactRequestLog hides the tokens, so that the debug output can be shared
+func redactRequestLog(requestLog *resty.RequestLog) error {
+	if requestLog.Header.Get("Authorization") != "" {
+		requestLog.Header.Set("Authorization", "<redacted>")
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package httpclient
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogger struct {
+	logger *log.Logger
+}
+
+func (l testLogger) Errorf(format string, v ...any) { l.logger.Printf(format, v...) }
+func (l testLogger) Warnf(format string, v ...any)  { l.logger.Printf(format, v...) }
+func (l testLogger) Debugf(format string, v ...any) { l.logger.Printf(format, v...) }
+
+// setRetryWaitTimes shortens the waits between retries for the test and restores them when it's done
+func setRetryWaitTimes(t *testing.T, waitTime, maxWaitTime time.Duration) {
+	originalWaitTime, originalMaxWaitTime := retryWaitTime, retryMaxWaitTime
+	t.Cleanup(func() {
+		retryWaitTime, retryMaxWaitTime = originalWaitTime, originalMaxWaitTime
+	})
+	retryWaitTime, retryMaxWaitTime = waitTime, maxWaitTime
+}
+
+func TestNew_Retries(t *testing.T) {
+	setRetryWaitTimes(t, time.Millisecond, 10*time.Millisecond)
+	tests := []struct {
+		name             string
+		method           string
+		failureCode      int
+		retries          int
+		wantRequests     int
+		wantStatusCode   int
+		failingResponses int
+	}{
+		{
+			name:             "GET is retried on server error",
+			method:           http.MethodGet,
+			failureCode:      http.StatusBadGateway,
+			retries:          3,
+			failingResponses: 2,
+			wantRequests:     3,
+			wantStatusCode:   http.StatusOK,
+		},
+		{
+			name:             "GET gives up after the configured retries",
+			method:           http.MethodGet,
+			failureCode:      http.StatusServiceUnavailable,
+			retries:          2,
+			failingResponses: 5,
+			wantRequests:     3,
+			wantStatusCode:   http.StatusServiceUnavailable,
+		},
+		{
+			name:             "POST is not retried on server error",
+			method:           http.MethodPost,
+			failureCode:      http.StatusInternalServerError,
+			retries:          3,
+			failingResponses: 2,
+			wantRequests:     1,
+			wantStatusCode:   http.StatusInternalServerError,
+		},
+		{
+			name:             "POST is retried when rate limited",
+			method:           http.MethodPost,
+			failureCode:      http.StatusTooManyRequests,
+			retries:          3,
+			failingResponses: 2,
+			wantRequests:     3,
+			wantStatusCode:   http.StatusOK,
+		},
+		{
+			name:             "client errors are not retried",
+			method:           http.MethodGet,
+			failureCode:      http.StatusNotFound,
+			retries:          3,
+			failingResponses: 2,
+			wantRequests:     1,
+			wantStatusCode:   http.StatusNotFound,
+		},
+		{
+			name:             "no retries configured",
+			method:           http.MethodGet,
+			failureCode:      http.StatusBadGateway,
+			retries:          0,
+			failingResponses: 2,
+			wantRequests:     1,
+			wantStatusCode:   http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tt.failingResponses {
+					w.WriteHeader(tt.failureCode)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer mockServer.Close()
+
+			httpClient := New(config.Config{HttpRetries: tt.retries})
+			resp, err := httpClient.R().Execute(tt.method, mockServer.URL)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatusCode, resp.StatusCode())
+			assert.Equal(t, tt.wantRequests, requests)
+		})
+	}
+}
+
+func TestNew_RetryAfter(t *testing.T) {
+	setRetryWaitTimes(t, time.Millisecond, time.Second)
+	requests := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	start := time.Now()
+	resp, err := New(config.Config{HttpRetries: 1}).R().Get(mockServer.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestNew_RetryAfterDateInThePast(t *testing.T) {
+	setRetryWaitTimes(t, time.Millisecond, 10*time.Second)
+	requests := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	start := time.Now()
+	resp, err := New(config.Config{HttpRetries: 1}).R().Get(mockServer.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	// the backoff is used instead of the maximum wait time
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestNew_SetsUserAgentAndTimeout(t *testing.T) {
+	var gotUserAgent string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserAgent = r.UserAgent()
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	httpClient := New(config.Config{HttpTimeout: 50 * time.Millisecond})
+	_, err := httpClient.R().Get(mockServer.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, userAgent, gotUserAgent)
+
+	_, err = httpClient.R().Get(mockServer.URL + "/slow")
+	assert.Error(t, err)
+}
+
+func TestNew_DebugRedactsTokens(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	var output bytes.Buffer
+	httpClient := New(config.Config{HttpDebug: true}).
+		SetLogger(testLogger{logger: log.New(&output, "", 0)})
+	_, err := httpClient.R().SetBasicAuth("apikey", "secret-token").Get(mockServer.URL)
+	assert.NoError(t, err)
+	_, err = httpClient.R().SetAuthToken("other-secret-token").Get(mockServer.URL)
+	assert.NoError(t, err)
+
+	assert.True(t, strings.Contains(output.String(), "<redacted>"))
+	assert.False(t, strings.Contains(output.String(), "secret-token"))
+	// basic auth is sent base64 encoded
+	assert.False(t, strings.Contains(output.String(), "YXBpa2V5OnNlY3JldC10b2tlbg=="))
+}
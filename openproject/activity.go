@@ -1,8 +1,17 @@
 package openproject
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/tidwall/gjson"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type Activity struct {
@@ -10,30 +19,265 @@ type Activity struct {
 	Name string `json:"name"`
 }
 
-func NewActivityFromWorkType(
-	config config.Config, issueId int, workType string,
-) (Activity, error) {
+// UnmappedWorkTypeError is returned if a work type cannot be mapped to an activity that is allowed in the project
+type UnmappedWorkTypeError struct {
+	WorkType      string
+	WorkPackageId int
+	Project       string
+	// MappedActivity is the activity the work type is mapped to in the config, but that is not allowed in the project
+	MappedActivity string
+}
+
+func (e UnmappedWorkTypeError) Error() string {
+	if e.MappedActivity != "" {
+		return fmt.Sprintf(
+			"Work Type '%v' is mapped to the activity '%v', which is not allowed in the project of work package '%v'\n",
+			e.WorkType, e.MappedActivity, e.WorkPackageId,
+		)
+	}
+	return fmt.Sprintf("Work Type '%v' is not a valid activity in OpenProject\n", e.WorkType)
+}
+
+type workPackageProject struct {
+	href  string
+	title string
+}
+
+// ActivityCache remembers the allowed activities per work package and per project for a whole run,
+// so that the time entry form of OpenProject does not have to be requested for every single time entry.
+// It's safe for concurrent use
+type ActivityCache struct {
+	mutex                   sync.Mutex
+	projectOfWorkPackage    map[int]workPackageProject
+	activitiesOfWorkPackage map[int][]Activity
+	activitiesOfProject     map[string][]Activity
+}
+
+func NewActivityCache() *ActivityCache {
+	return &ActivityCache{
+		projectOfWorkPackage:    map[int]workPackageProject{},
+		activitiesOfWorkPackage: map[int][]Activity{},
+		activitiesOfProject:     map[string][]Activity{},
+	}
+}
+
+// Prefetch looks up the projects of the given work packages with a single request.
+// After that the allowed activities are only requested once per project instead of once per work package
+func (c *ActivityCache) Prefetch(config config.Config, workPackageIds []int) error {
+	if len(workPackageIds) == 0 {
+		return nil
+	}
+	workPackages, err := getWorkpackages(config, workPackageIds)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rememberProjects(workPackages)
+	return nil
+}
+
+func (c *ActivityCache) rememberProjects(workPackages []WorkPackage) {
+	for _, workPackage := range workPackages {
+		if workPackage.Links.Project.Href != "" {
+			c.projectOfWorkPackage[workPackage.Id] = workPackageProject{
+				href:  workPackage.Links.Project.Href,
+				title: workPackage.Links.Project.Title,
+			}
+		}
+	}
+}
+
+// getProject returns the project of the work package, it's only requested if it was not prefetched
+func (c *ActivityCache) getProject(config config.Config, workPackageId int) (workPackageProject, error) {
+	c.mutex.Lock()
+	project, found := c.projectOfWorkPackage[workPackageId]
+	c.mutex.Unlock()
+	if found {
+		return project, nil
+	}
+	workPackages, err := getWorkpackages(config, []int{workPackageId})
+	if err != nil {
+		return workPackageProject{}, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rememberProjects(workPackages)
+	return c.projectOfWorkPackage[workPackageId], nil
+}
+
+// GetAllowedActivities returns the activities that can be used to log time on the work package
+func (c *ActivityCache) GetAllowedActivities(config config.Config, workPackageId int) ([]Activity, error) {
+	activities, project, projectKnown, found := c.cachedActivities(workPackageId)
+	if found {
+		return activities, nil
+	}
+
+	// the lock is not held during the request, so that parallel workers are not blocked by each other.
+	// Two workers might request the activities of the same project at the same time, which does no harm
 	workPackage := WorkPackage{
-		Id: issueId,
+		Id: workPackageId,
 	}
 	activities, err := workPackage.getAllowedActivities(config)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.activitiesOfWorkPackage[workPackageId] = activities
+	if projectKnown {
+		c.activitiesOfProject[project.href] = activities
+	}
+	return activities, nil
+}
+
+// cachedActivities returns the remembered activities of the work package or of its project, if there are any
+func (c *ActivityCache) cachedActivities(
+	workPackageId int,
+) (activities []Activity, project workPackageProject, projectKnown bool, found bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if activities, found = c.activitiesOfWorkPackage[workPackageId]; found {
+		return activities, project, projectKnown, true
+	}
+	project, projectKnown = c.projectOfWorkPackage[workPackageId]
+	if projectKnown {
+		activities, found = c.activitiesOfProject[project.href]
+	}
+	return activities, project, projectKnown, found
+}
+
+// NewActivityFromWorkType returns the activity that the work type is mapped to in the config,
+// or the activity with the same name, or the default activity
+func (c *ActivityCache) NewActivityFromWorkType(
+	config config.Config, issueId int, workType string,
+) (Activity, error) {
+	activities, err := c.GetAllowedActivities(config, issueId)
 	if err != nil {
 		return Activity{}, err
 	}
-	workTypeValid := false
-	var selectedActivity Activity
-	for _, activity := range activities {
-		if workType == activity.Name {
-			workTypeValid = true
-			selectedActivity = activity
+	var project workPackageProject
+	if len(config.ActivityMapping.Projects) > 0 {
+		project, err = c.getProject(config, issueId)
+		if err != nil {
+			return Activity{}, err
+		}
+	}
+	activity, err := resolveActivity(config.ActivityMapping, project, workType, activities)
+	var unmappedWorkTypeError UnmappedWorkTypeError
+	if errors.As(err, &unmappedWorkTypeError) {
+		unmappedWorkTypeError.WorkPackageId = issueId
+		return Activity{}, unmappedWorkTypeError
+	}
+	return activity, err
+}
+
+// resolveActivity finds the activity for the work type. The rules of the project are tried first, then the global
+// ones. If no rule matches, the activity with the name of the work type is used. If that does not exist, or the
+// activity of the matching rule is not allowed, the default activity of the project or the global one is used
+func resolveActivity(
+	mapping config.ActivityMapping, project workPackageProject, workType string, allowedActivities []Activity,
+) (Activity, error) {
+	findActivity := func(name string) (Activity, bool) {
+		for _, activity := range allowedActivities {
+			if activity.Name == name || (mapping.CaseInsensitive && strings.EqualFold(activity.Name, name)) {
+				return activity, true
+			}
+		}
+		return Activity{}, false
+	}
+
+	var mappingSets []config.ActivityMappingSet
+	for key, projectMappingSet := range mapping.Projects {
+		// viper turns all keys into lower case, so the name of the project cannot be compared case-sensitive
+		if (project.href != "" && key == path.Base(project.href)) ||
+			(project.title != "" && strings.EqualFold(key, project.title)) {
+			mappingSets = append(mappingSets, projectMappingSet)
 			break
 		}
 	}
-	if !workTypeValid {
-		return Activity{}, fmt.Errorf(
-			"Work Type '%v' is not a valid activity in OpenProject\n",
-			workType,
+	mappingSets = append(mappingSets, mapping.ActivityMappingSet)
+
+	findDefault := func() (Activity, bool) {
+		for _, mappingSet := range mappingSets {
+			if mappingSet.Default == "" {
+				continue
+			}
+			if activity, found := findActivity(mappingSet.Default); found {
+				return activity, true
+			}
+		}
+		return Activity{}, false
+	}
+
+	for _, mappingSet := range mappingSets {
+		for _, rule := range mappingSet.Mapping {
+			if !ruleMatches(rule, workType, mapping.CaseInsensitive) {
+				continue
+			}
+			if activity, found := findActivity(rule.Activity); found {
+				return activity, nil
+			}
+			// the mapped activity might not be enabled in every project, the default is meant for such cases
+			if activity, found := findDefault(); found {
+				return activity, nil
+			}
+			return Activity{}, UnmappedWorkTypeError{
+				WorkType: workType, Project: project.title, MappedActivity: rule.Activity,
+			}
+		}
+	}
+	if activity, found := findActivity(workType); found {
+		return activity, nil
+	}
+	if activity, found := findDefault(); found {
+		return activity, nil
+	}
+	return Activity{}, UnmappedWorkTypeError{WorkType: workType, Project: project.title}
+}
+
+func ruleMatches(rule config.ActivityMappingRule, workType string, caseInsensitive bool) bool {
+	if !rule.Regex {
+		return rule.WorkType == workType || (caseInsensitive && strings.EqualFold(rule.WorkType, workType))
+	}
+	expression := "^(?:" + rule.WorkType + ")$"
+	if caseInsensitive {
+		expression = "(?i)" + expression
+	}
+	matches, err := regexp.MatchString(expression, workType)
+	return err == nil && matches
+}
+
+func NewActivityFromWorkType(
+	config config.Config, issueId int, workType string,
+) (Activity, error) {
+	return NewActivityCache().NewActivityFromWorkType(config, issueId, workType)
+}
+
+// getWorkpackages fetches all the work packages with the given ids with a single request
+func getWorkpackages(config config.Config, workPackageIds []int) ([]WorkPackage, error) {
+	var ids []string
+	for _, id := range workPackageIds {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	idsJSON, _ := json.Marshal(ids)
+	httpClient := newHttpClient(config)
+	openProjectUrl, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/work_packages")
+	resp, err := httpClient.R().
+		SetHeader("Content-Type", "application/json").
+		SetQueryParam("pageSize", strconv.Itoa(len(ids))).
+		SetQueryParam("filters", fmt.Sprintf(`[{"id":{"operator":"=","values":%v}}]`, string(idsJSON))).
+		Get(openProjectUrl)
+	if err != nil || resp.StatusCode() != 200 {
+		return nil, fmt.Errorf(
+			"cannot read work packages from OpenProject. Error: '%v'. HTTP status code: %v", err, resp.StatusCode(),
 		)
 	}
-	return selectedActivity, nil
+	var workPackages []WorkPackage
+	workPackagesJSON := gjson.GetBytes(resp.Body(), "_embedded.elements")
+	err = json.Unmarshal([]byte(workPackagesJSON.String()), &workPackages)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing work packages response: %v", err)
+	}
+	return workPackages, nil
 }
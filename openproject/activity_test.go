@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewActivityFromWorkType(t *testing.T) {
@@ -150,3 +152,271 @@ func TestNewActivityFromWorkType(t *testing.T) {
 		})
 	}
 }
+
+func TestActivityCache_GetAllowedActivities(t *testing.T) {
+	workPackagesResponse := `{
+		"_embedded": {
+			"elements": [
+				{"id": 1, "subject": "WP 1", "_links": {"project": {"href": "/api/v3/projects/10", "title": "Project A"}}},
+				{"id": 2, "subject": "WP 2", "_links": {"project": {"href": "/api/v3/projects/10", "title": "Project A"}}},
+				{"id": 3, "subject": "WP 3", "_links": {"project": {"href": "/api/v3/projects/20", "title": "Project B"}}}
+			]
+		}
+	}`
+	formResponse := `{
+		"_embedded": {
+			"schema": {
+				"activity": {
+					"_embedded": {
+						"allowedValues": [{"id": 3, "name": "Development"}]
+					}
+				}
+			}
+		}
+	}`
+	var formRequests []string
+	var workPackageFilters string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/work_packages":
+			workPackageFilters = r.URL.Query().Get("filters")
+			w.Write([]byte(workPackagesResponse))
+		case "/api/v3/time_entries/form":
+			bodyBytes, _ := io.ReadAll(r.Body)
+			formRequests = append(formRequests, string(bodyBytes))
+			w.Write([]byte(formResponse))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+	config := config.Config{
+		OpenProjectToken: "dummyToken",
+		OpenProjectUrl:   mockServer.URL + "/",
+	}
+
+	cache := NewActivityCache()
+	err := cache.Prefetch(config, []int{1, 2, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"id":{"operator":"=","values":["1","2","3"]}}]`, workPackageFilters)
+
+	for _, workPackageId := range []int{1, 2, 3, 1, 4, 4} {
+		activities, err := cache.GetAllowedActivities(config, workPackageId)
+		assert.NoError(t, err)
+		assert.Equal(t, []Activity{{Id: 3, Name: "Development"}}, activities)
+	}
+	// one request for each of the two projects and one for the work package with unknown project
+	assert.Equal(t, []string{
+		`{"_links":{"workPackage":{"href":"/api/v3/work_packages/1"}}}`,
+		`{"_links":{"workPackage":{"href":"/api/v3/work_packages/3"}}}`,
+		`{"_links":{"workPackage":{"href":"/api/v3/work_packages/4"}}}`,
+	}, formRequests)
+
+	activity, err := cache.NewActivityFromWorkType(config, 2, "Development")
+	assert.NoError(t, err)
+	assert.Equal(t, Activity{Id: 3, Name: "Development"}, activity)
+	assert.Len(t, formRequests, 3)
+}
+
+func TestActivityCache_GetAllowedActivities_concurrent(t *testing.T) {
+	// every request waits till the other one arrived, that only works if the cache does not block while requesting
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		bothArrived := make(chan struct{})
+		go func() {
+			arrived.Wait()
+			close(bothArrived)
+		}()
+		select {
+		case <-bothArrived:
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.Write([]byte(`{"_embedded":{"schema":{"activity":{"_embedded":{"allowedValues":[
+			{"id":3,"name":"Development"}
+		]}}}}}`))
+	}))
+	defer mockServer.Close()
+	config := config.Config{
+		OpenProjectToken: "dummyToken",
+		OpenProjectUrl:   mockServer.URL + "/",
+	}
+
+	cache := NewActivityCache()
+	var workers sync.WaitGroup
+	for _, workPackageId := range []int{1, 2} {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			activities, err := cache.GetAllowedActivities(config, workPackageId)
+			assert.NoError(t, err)
+			assert.Equal(t, []Activity{{Id: 3, Name: "Development"}}, activities)
+		}()
+	}
+	workers.Wait()
+}
+
+func Test_resolveActivity(t *testing.T) {
+	allowedActivities := []Activity{
+		{Id: 1, Name: "Management"},
+		{Id: 2, Name: "Specification"},
+		{Id: 3, Name: "Development"},
+		{Id: 4, Name: "Communication"},
+	}
+	project := workPackageProject{href: "/api/v3/projects/12", title: "My Project"}
+	tests := []struct {
+		name               string
+		mapping            config.ActivityMapping
+		workType           string
+		want               Activity
+		wantErrMessage     string
+		wantMappedActivity string
+	}{
+		{
+			name:     "same name without mapping",
+			workType: "Development",
+			want:     Activity{Id: 3, Name: "Development"},
+		},
+		{
+			name:           "different case without case-insensitive mapping",
+			workType:       "development",
+			wantErrMessage: "Work Type 'development' is not a valid activity in OpenProject\n",
+		},
+		{
+			name:     "different case with case-insensitive mapping",
+			mapping:  config.ActivityMapping{CaseInsensitive: true},
+			workType: "development",
+			want:     Activity{Id: 3, Name: "Development"},
+		},
+		{
+			name: "global mapping",
+			mapping: config.ActivityMapping{ActivityMappingSet: config.ActivityMappingSet{
+				Mapping: []config.ActivityMappingRule{{WorkType: "Coding", Activity: "Development"}},
+			}},
+			workType: "Coding",
+			want:     Activity{Id: 3, Name: "Development"},
+		},
+		{
+			name: "mapping wins over the same name",
+			mapping: config.ActivityMapping{ActivityMappingSet: config.ActivityMappingSet{
+				Mapping: []config.ActivityMappingRule{{WorkType: "Management", Activity: "Communication"}},
+			}},
+			workType: "Management",
+			want:     Activity{Id: 4, Name: "Communication"},
+		},
+		{
+			name: "regex mapping has to match the whole name",
+			mapping: config.ActivityMapping{ActivityMappingSet: config.ActivityMappingSet{
+				Mapping: []config.ActivityMappingRule{
+					{WorkType: "Meeting", Regex: true, Activity: "Management"},
+					{WorkType: "Meeting.*", Regex: true, Activity: "Communication"},
+				},
+			}},
+			workType: "Meeting with customer",
+			want:     Activity{Id: 4, Name: "Communication"},
+		},
+		{
+			name: "case-insensitive regex mapping",
+			mapping: config.ActivityMapping{
+				CaseInsensitive: true,
+				ActivityMappingSet: config.ActivityMappingSet{
+					Mapping: []config.ActivityMappingRule{{WorkType: "meeting.*", Regex: true, Activity: "communication"}},
+				},
+			},
+			workType: "Meeting with customer",
+			want:     Activity{Id: 4, Name: "Communication"},
+		},
+		{
+			name: "project mapping by id wins over global mapping",
+			mapping: config.ActivityMapping{
+				ActivityMappingSet: config.ActivityMappingSet{
+					Mapping: []config.ActivityMappingRule{{WorkType: "Coding", Activity: "Development"}},
+				},
+				Projects: map[string]config.ActivityMappingSet{
+					"12": {Mapping: []config.ActivityMappingRule{{WorkType: "Coding", Activity: "Specification"}}},
+				},
+			},
+			workType: "Coding",
+			want:     Activity{Id: 2, Name: "Specification"},
+		},
+		{
+			name: "project mapping by name",
+			mapping: config.ActivityMapping{
+				Projects: map[string]config.ActivityMappingSet{
+					"my project": {Mapping: []config.ActivityMappingRule{{WorkType: "Coding", Activity: "Specification"}}},
+				},
+			},
+			workType: "Coding",
+			want:     Activity{Id: 2, Name: "Specification"},
+		},
+		{
+			name: "mapping of other project is not used",
+			mapping: config.ActivityMapping{
+				Projects: map[string]config.ActivityMappingSet{
+					"13": {Mapping: []config.ActivityMappingRule{{WorkType: "Coding", Activity: "Specification"}}},
+				},
+			},
+			workType:       "Coding",
+			wantErrMessage: "Work Type 'Coding' is not a valid activity in OpenProject\n",
+		},
+		{
+			name: "mapped activity is not allowed",
+			mapping: config.ActivityMapping{ActivityMappingSet: config.ActivityMappingSet{
+				Mapping: []config.ActivityMappingRule{{WorkType: "Coding", Activity: "Testing"}},
+			}},
+			workType:           "Coding",
+			wantErrMessage:     "Work Type 'Coding' is mapped to the activity 'Testing', which is not allowed",
+			wantMappedActivity: "Testing",
+		},
+		{
+			name: "default if the mapped activity is not allowed",
+			mapping: config.ActivityMapping{ActivityMappingSet: config.ActivityMappingSet{
+				Mapping: []config.ActivityMappingRule{{WorkType: "Coding", Activity: "Testing"}},
+				Default: "Development",
+			}},
+			workType: "Coding",
+			want:     Activity{Id: 3, Name: "Development"},
+		},
+		{
+			name: "project default wins over global default",
+			mapping: config.ActivityMapping{
+				ActivityMappingSet: config.ActivityMappingSet{Default: "Development"},
+				Projects: map[string]config.ActivityMappingSet{
+					"12": {Default: "Management"},
+				},
+			},
+			workType: "Something",
+			want:     Activity{Id: 1, Name: "Management"},
+		},
+		{
+			name: "global default if the project default is not allowed",
+			mapping: config.ActivityMapping{
+				ActivityMappingSet: config.ActivityMappingSet{Default: "Development"},
+				Projects: map[string]config.ActivityMappingSet{
+					"12": {Default: "Testing"},
+				},
+			},
+			workType: "Something",
+			want:     Activity{Id: 3, Name: "Development"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveActivity(tt.mapping, project, tt.workType, allowedActivities)
+			if tt.wantErrMessage != "" {
+				assert.ErrorContains(t, err, tt.wantErrMessage)
+				var unmappedWorkTypeError UnmappedWorkTypeError
+				assert.ErrorAs(t, err, &unmappedWorkTypeError)
+				assert.Equal(t, tt.workType, unmappedWorkTypeError.WorkType)
+				assert.Equal(t, "My Project", unmappedWorkTypeError.Project)
+				assert.Equal(t, tt.wantMappedActivity, unmappedWorkTypeError.MappedActivity)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -24,12 +24,18 @@ import (
 	"strconv"
 
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/httpclient"
 	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
+// newHttpClient returns a client that is authenticated against OpenProject
+func newHttpClient(config config.Config) *resty.Client {
+	return httpclient.New(config).SetBasicAuth("apikey", config.OpenProjectToken)
+}
+
 func GetAllTimeEntries(config *config.Config, user User, startDate string, endDate string, workpackages []any) ([]TimeEntry, error) {
-	httpClient := resty.New()
+	httpClient := newHttpClient(*config)
 	openProjectUrl, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/time_entries")
 	var userString string
 
@@ -48,7 +54,6 @@ func GetAllTimeEntries(config *config.Config, user User, startDate string, endDa
 	// the operator is '<>d' ("\u003c\u003ed") and means between the dates
 	filters += fmt.Sprintf(`{"user":{"operator":"=","values":["%v"]}},{"spent_on":{"operator":"\u003c\u003ed","values":["%v","%v"]}}]`, userString, startDate, endDate)
 	resp, err := httpClient.R().
-		SetBasicAuth("apikey", config.OpenProjectToken).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParam("pageSize", "3000").
 		SetQueryParam("sortBy", "[[\"updated_at\",\"asc\"]]").
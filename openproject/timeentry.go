@@ -2,15 +2,24 @@ package openproject
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
 	"github.com/go-chrono/chrono"
-	"github.com/go-resty/resty/v2"
 	"net/url"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Link is a link to another resource in the HAL responses of OpenProject
+type Link struct {
+	Href string `json:"href"`
+}
+
 type TimeEntry struct {
+	Id      int  `json:"id,omitempty"`
 	Ongoing bool `json:"ongoing"`
 	Comment struct {
 		Raw string `json:"raw"`
@@ -18,6 +27,8 @@ type TimeEntry struct {
 	SpentOn string `json:"spentOn"`
 	Hours   string `json:"hours"`
 	Links   struct {
+		// Self is only set for entries that exist in OpenProject, a new entry must not send it
+		Self        *Link `json:"self,omitempty"`
 		WorkPackage struct {
 			Href  string `json:"href"`
 			Title string `json:"title"`
@@ -37,25 +48,125 @@ type TimeEntry struct {
 	} `json:"_links"`
 }
 
-func (timeEntry TimeEntry) Save(config config.Config) error {
+// Save creates the time entry in OpenProject and returns the created entry including its id and self link
+func (timeEntry TimeEntry) Save(config config.Config) (TimeEntry, error) {
 	entryJSON, err := json.Marshal(timeEntry)
 	if err != nil {
-		return fmt.Errorf("error marshalling OpenProject time entry to JSON: %v", err)
+		return TimeEntry{}, fmt.Errorf("error marshalling OpenProject time entry to JSON: %v", err)
 	}
-	httpClient := resty.New()
+	httpClient := newHttpClient(config)
 	wpURL, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/time_entries/")
 	resp, err := httpClient.R().
-		SetBasicAuth("apikey", config.OpenProjectToken).
 		SetHeader("Content-Type", "application/hal+json; charset=utf-8").
 		SetBody(entryJSON).
 		Post(wpURL)
 	if err != nil || resp.StatusCode() != 201 {
-		return fmt.Errorf(
+		return TimeEntry{}, fmt.Errorf(
 			"could not save time entry in OpenProject. Error: '%v'. HTTP status code: %v", err, resp.StatusCode(),
 		)
 	}
+	var createdEntry TimeEntry
+	err = json.Unmarshal(resp.Body(), &createdEntry)
+	if err != nil || createdEntry.Id == 0 {
+		return TimeEntry{}, fmt.Errorf(
+			"time entry was saved in OpenProject, but the response could not be parsed. Error: '%v'", err,
+		)
+	}
+	return createdEntry, nil
+}
+
+// SelfHref returns the API path of the entry, or an empty string if the entry does not exist in OpenProject
+func (timeEntry TimeEntry) SelfHref() string {
+	if timeEntry.Links.Self == nil {
+		return ""
+	}
+	return timeEntry.Links.Self.Href
+}
+
+// GetTimeEntry fetches a single time entry from OpenProject by its id
+func GetTimeEntry(config config.Config, id int) (TimeEntry, error) {
+	httpClient := newHttpClient(config)
+	timeEntryURL, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/time_entries/", strconv.Itoa(id))
+	resp, err := httpClient.R().
+		Get(timeEntryURL)
+	if err != nil || resp.StatusCode() != 200 {
+		return TimeEntry{}, fmt.Errorf(
+			"could not read time entry '%v' from OpenProject. Error: '%v'. HTTP status code: %v",
+			id, err, resp.StatusCode(),
+		)
+	}
+	var timeEntry TimeEntry
+	err = json.Unmarshal(resp.Body(), &timeEntry)
+	if err != nil {
+		return TimeEntry{}, fmt.Errorf("error parsing time entry response: %v", err)
+	}
+	return timeEntry, nil
+}
+
+// Update changes the time entry with the given id in OpenProject to the values of this time entry
+func (timeEntry TimeEntry) Update(config config.Config, id int) error {
+	timeEntry.Id = 0
+	entryJSON, err := json.Marshal(timeEntry)
+	if err != nil {
+		return fmt.Errorf("error marshalling OpenProject time entry to JSON: %v", err)
+	}
+	httpClient := newHttpClient(config)
+	timeEntryURL, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/time_entries/", strconv.Itoa(id))
+	resp, err := httpClient.R().
+		SetHeader("Content-Type", "application/hal+json; charset=utf-8").
+		SetBody(entryJSON).
+		Patch(timeEntryURL)
+	if err != nil || resp.StatusCode() != 200 {
+		return fmt.Errorf(
+			"could not update time entry '%v' in OpenProject. Error: '%v'. HTTP status code: %v",
+			id, err, resp.StatusCode(),
+		)
+	}
 	return nil
 }
+
+// ErrTimeEntryNotFound is returned if the time entry does not exist in OpenProject, e.g. because it was deleted already
+var ErrTimeEntryNotFound = errors.New("time entry not found in OpenProject")
+
+// DeleteTimeEntry deletes the time entry with the given id from OpenProject
+func DeleteTimeEntry(config config.Config, id int) error {
+	httpClient := newHttpClient(config)
+	timeEntryURL, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/time_entries/", strconv.Itoa(id))
+	resp, err := httpClient.R().
+		Delete(timeEntryURL)
+	if err == nil && resp.StatusCode() == 404 {
+		return fmt.Errorf("could not delete time entry '%v': %w", id, ErrTimeEntryNotFound)
+	}
+	if err != nil || resp.StatusCode() != 204 {
+		return fmt.Errorf(
+			"could not delete time entry '%v' in OpenProject. Error: '%v'. HTTP status code: %v",
+			id, err, resp.StatusCode(),
+		)
+	}
+	return nil
+}
+
+// Matches returns true if both time entries are booked on the same day and work package
+// with the same activity, comment and duration
+func (timeEntry TimeEntry) Matches(other TimeEntry) bool {
+	if timeEntry.SpentOn != other.SpentOn ||
+		path.Base(timeEntry.Links.WorkPackage.Href) != path.Base(other.Links.WorkPackage.Href) ||
+		path.Base(timeEntry.Links.Activity.Href) != path.Base(other.Links.Activity.Href) ||
+		strings.TrimSpace(timeEntry.Comment.Raw) != strings.TrimSpace(other.Comment.Raw) {
+		return false
+	}
+	duration, err := timeEntry.GetDuration()
+	if err != nil {
+		return false
+	}
+	otherDuration, err := other.GetDuration()
+	if err != nil {
+		return false
+	}
+	// OpenProject stores the hours as a decimal number, so seconds might get lost on the way
+	return duration.Round(time.Minute) == otherDuration.Round(time.Minute)
+}
+
 func (timeEntry TimeEntry) GetDuration() (time.Duration, error) {
 	_, duration, err := chrono.ParseDuration(timeEntry.Hours)
 	if err != nil {
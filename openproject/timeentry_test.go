@@ -0,0 +1,279 @@
+package openproject
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTimeEntry(spentOn string, workPackageId string, activityId string, comment string, hours string) TimeEntry {
+	timeEntry := TimeEntry{SpentOn: spentOn, Hours: hours}
+	timeEntry.Comment.Raw = comment
+	timeEntry.Links.WorkPackage.Href = "/api/v3/work_packages/" + workPackageId
+	timeEntry.Links.Activity.Href = "/api/v3/time_entries/activities/" + activityId
+	return timeEntry
+}
+
+func TestTimeEntry_Matches(t *testing.T) {
+	entryToCreate := newTestTimeEntry("2024-01-31", "1234", "3", "fixing the login", "P0DT1H30M0S")
+	tests := []struct {
+		name          string
+		existingEntry TimeEntry
+		want          bool
+	}{
+		{
+			name:          "same entry as returned by OpenProject",
+			existingEntry: newTestTimeEntry("2024-01-31", "1234", "3", "fixing the login", "PT1H30M"),
+			want:          true,
+		},
+		{
+			name:          "duration differs only in seconds",
+			existingEntry: newTestTimeEntry("2024-01-31", "1234", "3", "fixing the login", "PT1H29M59S"),
+			want:          true,
+		},
+		{
+			name:          "different duration",
+			existingEntry: newTestTimeEntry("2024-01-31", "1234", "3", "fixing the login", "PT1H"),
+			want:          false,
+		},
+		{
+			name:          "different activity",
+			existingEntry: newTestTimeEntry("2024-01-31", "1234", "4", "fixing the login", "PT1H30M"),
+			want:          false,
+		},
+		{
+			name:          "different comment",
+			existingEntry: newTestTimeEntry("2024-01-31", "1234", "3", "fixing the logout", "PT1H30M"),
+			want:          false,
+		},
+		{
+			name:          "different day",
+			existingEntry: newTestTimeEntry("2024-02-01", "1234", "3", "fixing the login", "PT1H30M"),
+			want:          false,
+		},
+		{
+			name:          "different work package",
+			existingEntry: newTestTimeEntry("2024-01-31", "1235", "3", "fixing the login", "PT1H30M"),
+			want:          false,
+		},
+		{
+			name:          "invalid duration",
+			existingEntry: newTestTimeEntry("2024-01-31", "1234", "3", "fixing the login", "invalid"),
+			want:          false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.existingEntry.Matches(entryToCreate); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeEntry_Save(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockResponse   string
+		mockStatusCode int
+		wantId         int
+		wantSelfHref   string
+		wantErr        bool
+		wantErrMessage string
+	}{
+		{
+			name: "created",
+			mockResponse: `{
+				"_type": "TimeEntry",
+				"id": 42,
+				"hours": "PT1H30M",
+				"spentOn": "2024-01-31",
+				"_links": {
+					"self": {"href": "/api/v3/time_entries/42"},
+					"workPackage": {"href": "/api/v3/work_packages/1234", "title": "Login"}
+				}
+			}`,
+			mockStatusCode: http.StatusCreated,
+			wantId:         42,
+			wantSelfHref:   "/api/v3/time_entries/42",
+		},
+		{
+			name:           "validation error",
+			mockResponse:   `{"_type":"Error","message":"Activity is not set to one of the allowed values."}`,
+			mockStatusCode: http.StatusUnprocessableEntity,
+			wantErr:        true,
+			wantErrMessage: "could not save time entry in OpenProject. Error: '<nil>'. HTTP status code: 422",
+		},
+		{
+			name:           "unexpected response",
+			mockResponse:   `not json`,
+			mockStatusCode: http.StatusCreated,
+			wantErr:        true,
+			wantErrMessage: "time entry was saved in OpenProject, but the response could not be parsed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestMethod, requestPath, requestBody string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestMethod = r.Method
+				requestPath = r.URL.Path
+				bodyBytes, _ := io.ReadAll(r.Body)
+				requestBody = string(bodyBytes)
+				w.WriteHeader(tt.mockStatusCode)
+				w.Write([]byte(tt.mockResponse))
+			}))
+			defer mockServer.Close()
+			config := config.Config{
+				OpenProjectToken: "dummyToken",
+				OpenProjectUrl:   mockServer.URL + "/",
+			}
+
+			timeEntry := newTestTimeEntry("2024-01-31", "1234", "3", "fixing the login", "P0DT1H30M0S")
+			got, err := timeEntry.Save(config)
+			assert.Equal(t, http.MethodPost, requestMethod)
+			assert.Equal(t, "/api/v3/time_entries/", requestPath)
+			// the new entry has no self link yet, OpenProject must not get an empty one
+			assert.NotContains(t, requestBody, `"self"`)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, tt.wantErrMessage)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantId, got.Id)
+			assert.Equal(t, tt.wantSelfHref, got.SelfHref())
+		})
+	}
+}
+
+func TestGetTimeEntry(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockResponse   string
+		mockStatusCode int
+		wantHours      string
+		wantErr        bool
+		wantErrMessage string
+	}{
+		{
+			name:           "existing entry",
+			mockResponse:   `{"id": 42, "hours": "PT2H", "spentOn": "2024-01-31", "comment": {"raw": "fixing the login"}}`,
+			mockStatusCode: http.StatusOK,
+			wantHours:      "PT2H",
+		},
+		{
+			name:           "deleted entry",
+			mockResponse:   `{"_type":"Error","errorIdentifier":"urn:openproject-org:api:v3:errors:NotFound"}`,
+			mockStatusCode: http.StatusNotFound,
+			wantErr:        true,
+			wantErrMessage: "could not read time entry '42' from OpenProject. Error: '<nil>'. HTTP status code: 404",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestPath string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestPath = r.URL.Path
+				w.WriteHeader(tt.mockStatusCode)
+				w.Write([]byte(tt.mockResponse))
+			}))
+			defer mockServer.Close()
+			config := config.Config{
+				OpenProjectToken: "dummyToken",
+				OpenProjectUrl:   mockServer.URL + "/",
+			}
+
+			got, err := GetTimeEntry(config, 42)
+			assert.Equal(t, "/api/v3/time_entries/42", requestPath)
+			if tt.wantErr {
+				assert.EqualError(t, err, tt.wantErrMessage)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 42, got.Id)
+			assert.Equal(t, tt.wantHours, got.Hours)
+		})
+	}
+}
+
+func TestTimeEntry_Update(t *testing.T) {
+	var requestMethod, requestPath, requestBody string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestMethod = r.Method
+		requestPath = r.URL.Path
+		bodyBytes, _ := io.ReadAll(r.Body)
+		requestBody = string(bodyBytes)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id": 42}`))
+	}))
+	defer mockServer.Close()
+	config := config.Config{
+		OpenProjectToken: "dummyToken",
+		OpenProjectUrl:   mockServer.URL + "/",
+	}
+
+	timeEntry := newTestTimeEntry("2024-01-31", "1234", "3", "fixing the login", "P0DT2H0M0S")
+	err := timeEntry.Update(config, 42)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPatch, requestMethod)
+	assert.Equal(t, "/api/v3/time_entries/42", requestPath)
+	assert.Contains(t, requestBody, `"hours":"P0DT2H0M0S"`)
+	assert.Contains(t, requestBody, `"workPackage":{"href":"/api/v3/work_packages/1234","title":""}`)
+	assert.NotContains(t, requestBody, `"id"`)
+}
+
+func TestDeleteTimeEntry(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockStatusCode int
+		wantErr        bool
+		wantErrMessage string
+	}{
+		{
+			name:           "deleted",
+			mockStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "no permission",
+			mockStatusCode: http.StatusForbidden,
+			wantErr:        true,
+			wantErrMessage: "could not delete time entry '42' in OpenProject. Error: '<nil>'. HTTP status code: 403",
+		},
+		{
+			name:           "deleted already",
+			mockStatusCode: http.StatusNotFound,
+			wantErr:        true,
+			wantErrMessage: "could not delete time entry '42': time entry not found in OpenProject",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestMethod, requestPath string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestMethod = r.Method
+				requestPath = r.URL.Path
+				w.WriteHeader(tt.mockStatusCode)
+			}))
+			defer mockServer.Close()
+			config := config.Config{
+				OpenProjectToken: "dummyToken",
+				OpenProjectUrl:   mockServer.URL + "/",
+			}
+
+			err := DeleteTimeEntry(config, 42)
+			assert.Equal(t, http.MethodDelete, requestMethod)
+			assert.Equal(t, "/api/v3/time_entries/42", requestPath)
+			if tt.wantErr {
+				assert.EqualError(t, err, tt.wantErrMessage)
+				assert.Equal(t, tt.mockStatusCode == http.StatusNotFound, errors.Is(err, ErrTimeEntryNotFound))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
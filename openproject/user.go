@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 	"net/url"
 )
@@ -16,10 +15,9 @@ type User struct {
 
 // FindUserByName searches for users that match the given search and returns the first match.
 func FindUserByName(config *config.Config, search string) (User, error) {
-	httpClient := resty.New()
+	httpClient := newHttpClient(*config)
 	openProjectUrl, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/principals")
 	resp, err := httpClient.R().
-		SetBasicAuth("apikey", config.OpenProjectToken).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParam("sortBy", "[[\"name\",\"desc\"]]").
 		SetQueryParam("filters", fmt.Sprintf(
@@ -47,3 +45,23 @@ func FindUserByName(config *config.Config, search string) (User, error) {
 		"cannot find a user in OpenProject with a name matching '%v'", search,
 	)
 }
+
+// GetCurrentUser returns the user the token in the configuration belongs to
+func GetCurrentUser(config *config.Config) (User, error) {
+	httpClient := newHttpClient(*config)
+	openProjectUrl, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/users/me")
+	resp, err := httpClient.R().
+		SetHeader("Content-Type", "application/json").
+		Get(openProjectUrl)
+	if err != nil || resp.StatusCode() != 200 {
+		return User{}, fmt.Errorf(
+			"cannot get the current user from OpenProject. Error: '%v'. HTTP status code: %v", err, resp.StatusCode(),
+		)
+	}
+	var user User
+	err = json.Unmarshal(resp.Body(), &user)
+	if err != nil {
+		return User{}, fmt.Errorf("error parsing user response from OpenProject: %v", err)
+	}
+	return user, nil
+}
@@ -117,3 +117,53 @@ func TestFindUserByName(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCurrentUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockResponse   string
+		mockStatusCode int
+		want           User
+		wantErrMessage string
+	}{
+		{
+			name:           "valid user",
+			mockResponse:   `{"_type": "User", "id": 1234, "name": "Peter Pan"}`,
+			mockStatusCode: http.StatusOK,
+			want:           User{Id: 1234, Name: "Peter Pan"},
+		},
+		{
+			name:           "invalid token",
+			mockResponse:   `{"_type": "Error", "message": "You did not provide the correct credentials."}`,
+			mockStatusCode: http.StatusUnauthorized,
+			wantErrMessage: "cannot get the current user from OpenProject. Error: '<nil>'. HTTP status code: 401",
+		},
+		{
+			name:           "wrongly formatted response",
+			mockResponse:   `{[],]}`,
+			mockStatusCode: http.StatusOK,
+			wantErrMessage: "error parsing user response from OpenProject",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestPath string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestPath = r.URL.Path
+				w.WriteHeader(tt.mockStatusCode)
+				w.Write([]byte(tt.mockResponse))
+			}))
+			defer mockServer.Close()
+			config := config.Config{OpenProjectUrl: mockServer.URL, OpenProjectToken: "dummyToken"}
+
+			got, err := GetCurrentUser(&config)
+			if tt.wantErrMessage != "" {
+				assert.ErrorContains(t, err, tt.wantErrMessage)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, "/api/v3/users/me", requestPath)
+		})
+	}
+}
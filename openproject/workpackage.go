@@ -21,14 +21,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 	"net/url"
+	"path"
+	"strconv"
 )
 
 type WorkPackage struct {
 	Subject string `json:"subject"`
 	Id      int    `json:"id"`
+	Links   struct {
+		Project struct {
+			Href  string `json:"href"`
+			Title string `json:"title"`
+		} `json:"project"`
+	} `json:"_links"`
 }
 
 func NewWorkPackage(id int, subject string) WorkPackage {
@@ -39,11 +46,10 @@ func NewWorkPackage(id int, subject string) WorkPackage {
 }
 
 func GetWorkpackage(workPackageId string, config *config.Config) (WorkPackage, error) {
-	openProjectHttpClient := resty.New()
+	openProjectHttpClient := newHttpClient(*config)
 
 	wpURL, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/work_packages/", workPackageId)
 	resp, err := openProjectHttpClient.R().
-		SetBasicAuth("apikey", config.OpenProjectToken).
 		Get(wpURL)
 
 	if err != nil || resp.StatusCode() != 200 {
@@ -60,12 +66,92 @@ func GetWorkpackage(workPackageId string, config *config.Config) (WorkPackage, e
 	return workPackage, err
 }
 
+// GetMemberProjectIds returns the ids of the projects the user is a member of
+func GetMemberProjectIds(config *config.Config, user User) ([]string, error) {
+	httpClient := newHttpClient(*config)
+	openProjectUrl, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/memberships")
+	resp, err := httpClient.R().
+		SetHeader("Content-Type", "application/json").
+		SetQueryParam("pageSize", "1000").
+		SetQueryParam("filters", fmt.Sprintf(`[{"principal":{"operator":"=","values":["%v"]}}]`, user.Id)).
+		Get(openProjectUrl)
+	if err != nil || resp.StatusCode() != 200 {
+		return nil, fmt.Errorf(
+			"cannot read the memberships from OpenProject. Error: '%v'. HTTP status code: %v", err, resp.StatusCode(),
+		)
+	}
+	var projectIds []string
+	// global memberships have no project
+	for _, href := range gjson.GetBytes(resp.Body(), "_embedded.elements.#._links.project.href").Array() {
+		if href.String() != "" {
+			projectIds = append(projectIds, path.Base(href.String()))
+		}
+	}
+	return projectIds, nil
+}
+
+// SearchWorkPackages returns the work packages that contain the search term, e.g. in the subject or description,
+// most recently updated first. If projectIds are given only work packages of these projects are returned
+func SearchWorkPackages(config *config.Config, searchTerm string, projectIds []string, limit int) ([]WorkPackage, error) {
+	filters := []map[string]any{
+		{"search": map[string]any{"operator": "**", "values": []string{searchTerm}}},
+	}
+	if len(projectIds) > 0 {
+		filters = append(filters, map[string]any{"project": map[string]any{"operator": "=", "values": projectIds}})
+	}
+	filtersJSON, _ := json.Marshal(filters)
+	httpClient := newHttpClient(*config)
+	openProjectUrl, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/work_packages")
+	resp, err := httpClient.R().
+		SetHeader("Content-Type", "application/json").
+		SetQueryParam("pageSize", strconv.Itoa(limit)).
+		SetQueryParam("sortBy", "[[\"updatedAt\",\"desc\"]]").
+		SetQueryParam("filters", string(filtersJSON)).
+		Get(openProjectUrl)
+	if err != nil || resp.StatusCode() != 200 {
+		return nil, fmt.Errorf(
+			"cannot search work packages in OpenProject. Error: '%v'. HTTP status code: %v", err, resp.StatusCode(),
+		)
+	}
+	var workPackages []WorkPackage
+	workPackagesJSON := gjson.GetBytes(resp.Body(), "_embedded.elements")
+	err = json.Unmarshal([]byte(workPackagesJSON.String()), &workPackages)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing work packages response: %v", err)
+	}
+	return workPackages, nil
+}
+
+// GetRecentWorkPackages returns the work packages the current user logged time on between the dates,
+// the one with the latest updated time entry first
+func GetRecentWorkPackages(config *config.Config, startDate string, endDate string) ([]WorkPackage, error) {
+	timeEntries, err := GetAllTimeEntries(config, User{}, startDate, endDate, nil)
+	if err != nil {
+		return nil, err
+	}
+	var workPackages []WorkPackage
+	known := map[int]bool{}
+	// the time entries are sorted by the time they were updated, oldest first
+	for i := len(timeEntries) - 1; i >= 0; i-- {
+		entry := timeEntries[i]
+		id, err := strconv.Atoi(path.Base(entry.Links.WorkPackage.Href))
+		if err != nil || known[id] {
+			continue
+		}
+		known[id] = true
+		workPackage := NewWorkPackage(id, entry.Links.WorkPackage.Title)
+		workPackage.Links.Project.Href = entry.Links.Project.Href
+		workPackage.Links.Project.Title = entry.Links.Project.Title
+		workPackages = append(workPackages, workPackage)
+	}
+	return workPackages, nil
+}
+
 func (w *WorkPackage) getAllowedActivities(config config.Config) ([]Activity, error) {
-	httpClient := resty.New()
+	httpClient := newHttpClient(config)
 	openProjectUrl, _ := url.JoinPath(config.OpenProjectUrl, "/api/v3/time_entries/form")
 	body := fmt.Sprintf(`{"_links":{"workPackage":{"href":"/api/v3/work_packages/%d"}}}`, w.Id)
 	resp, err := httpClient.R().
-		SetBasicAuth("apikey", config.OpenProjectToken).
 		SetHeader("Content-Type", "application/json").
 		SetBody(body).
 		Post(openProjectUrl)
@@ -0,0 +1,108 @@
+package openproject
+
+import (
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSearchWorkPackages(t *testing.T) {
+	tests := []struct {
+		name            string
+		projectIds      []string
+		mockResponse    string
+		mockStatusCode  int
+		expectedFilters string
+		expected        []WorkPackage
+		expectedError   string
+	}{
+		{
+			name:       "search in projects",
+			projectIds: []string{"3", "5"},
+			mockResponse: `{"_embedded":{"elements":[
+				{"id":12,"subject":"Login \"broken\""},{"id":7,"subject":"Login page"}
+			]}}`,
+			mockStatusCode: http.StatusOK,
+			expectedFilters: `[{"search":{"operator":"**","values":["login \"page\""]}},` +
+				`{"project":{"operator":"=","values":["3","5"]}}]`,
+			expected: []WorkPackage{NewWorkPackage(12, `Login "broken"`), NewWorkPackage(7, "Login page")},
+		},
+		{
+			name:            "search in all projects",
+			mockResponse:    `{"_embedded":{"elements":[]}}`,
+			mockStatusCode:  http.StatusOK,
+			expectedFilters: `[{"search":{"operator":"**","values":["login \"page\""]}}]`,
+			expected:        []WorkPackage{},
+		},
+		{
+			name:            "server error",
+			mockStatusCode:  http.StatusInternalServerError,
+			expectedFilters: `[{"search":{"operator":"**","values":["login \"page\""]}}]`,
+			expectedError:   "cannot search work packages in OpenProject",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filters, pageSize string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				filters = r.URL.Query().Get("filters")
+				pageSize = r.URL.Query().Get("pageSize")
+				w.WriteHeader(tt.mockStatusCode)
+				w.Write([]byte(tt.mockResponse))
+			}))
+			defer mockServer.Close()
+			config := config.Config{OpenProjectUrl: mockServer.URL, OpenProjectToken: "dummyToken"}
+
+			workPackages, err := SearchWorkPackages(&config, `login "page"`, tt.projectIds, 20)
+			assert.Equal(t, tt.expectedFilters, filters)
+			assert.Equal(t, "20", pageSize)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, workPackages)
+		})
+	}
+}
+
+func TestGetMemberProjectIds(t *testing.T) {
+	var filters string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filters = r.URL.Query().Get("filters")
+		w.Write([]byte(`{"_embedded":{"elements":[
+			{"_links":{"project":{"href":"/api/v3/projects/3"}}},
+			{"_links":{"project":{"href":null}}},
+			{"_links":{"project":{"href":"/api/v3/projects/5"}}}
+		]}}`))
+	}))
+	defer mockServer.Close()
+	config := config.Config{OpenProjectUrl: mockServer.URL, OpenProjectToken: "dummyToken"}
+
+	projectIds, err := GetMemberProjectIds(&config, User{Id: 42})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "5"}, projectIds)
+	assert.Equal(t, `[{"principal":{"operator":"=","values":["42"]}}]`, filters)
+}
+
+func TestGetRecentWorkPackages(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"_embedded":{"elements":[
+			{"id":1,"_links":{"workPackage":{"href":"/api/v3/work_packages/12","title":"Old"}}},
+			{"id":2,"_links":{"workPackage":{"href":"/api/v3/work_packages/7","title":"Newer"},
+				"project":{"href":"/api/v3/projects/3","title":"Demo"}}},
+			{"id":3,"_links":{"workPackage":{"href":"/api/v3/work_packages/12","title":"Old"}}}
+		]}}`))
+	}))
+	defer mockServer.Close()
+	config := config.Config{OpenProjectUrl: mockServer.URL, OpenProjectToken: "dummyToken"}
+
+	workPackages, err := GetRecentWorkPackages(&config, "2024-05-01", "2024-05-10")
+	assert.NoError(t, err)
+	expectedWithProject := NewWorkPackage(7, "Newer")
+	expectedWithProject.Links.Project.Href = "/api/v3/projects/3"
+	expectedWithProject.Links.Project.Title = "Demo"
+	assert.Equal(t, []WorkPackage{NewWorkPackage(12, "Old"), expectedWithProject}, workPackages)
+}
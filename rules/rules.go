@@ -0,0 +1,178 @@
+/*
+Copyright © 2024 JankariTech Pvt. Ltd. info@jankaritech.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"gopkg.in/yaml.v3"
+)
+
+// Condition selects time entries. Every condition that is set has to match
+type Condition struct {
+	// Note is a regular expression that has to match a part of the note of the entry
+	Note string `yaml:"note"`
+	// Project is the name of the tmetric project, the case does not matter
+	Project string `yaml:"project"`
+	// Task is a regular expression that has to match a part of the name of the tmetric task
+	Task string `yaml:"task"`
+
+	noteRegex *regexp.Regexp
+	taskRegex *regexp.Regexp
+}
+
+// WorkPackageRule links the matching entries to a work package.
+// If WorkPackage is not set, the first group of the Note expression is used as the id, e.g. 'OP-(\d+)'
+type WorkPackageRule struct {
+	Condition   `yaml:",inline"`
+	WorkPackage int `yaml:"workPackage"`
+}
+
+// WorkTypeRule sets the work type of the matching entries
+type WorkTypeRule struct {
+	Condition `yaml:",inline"`
+	WorkType  string `yaml:"workType"`
+}
+
+// Rules fix the time entries in tmetric without asking. The first matching rule of a list is used
+type Rules struct {
+	WorkPackages []WorkPackageRule `yaml:"workPackages"`
+	WorkTypes    []WorkTypeRule    `yaml:"workTypes"`
+}
+
+// Load reads the rules from a YAML file and checks them
+func Load(path string) (*Rules, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the rules file '%v': %v", path, err)
+	}
+	rules := &Rules{}
+	err = yaml.Unmarshal(content, rules)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the rules file '%v': %v", path, err)
+	}
+	err = rules.compile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules file '%v':\n%v", path, err)
+	}
+	return rules, nil
+}
+
+// compile checks the rules and prepares their regular expressions
+func (rules *Rules) compile() error {
+	var problems []string
+	for i := range rules.WorkPackages {
+		rule := &rules.WorkPackages[i]
+		key := fmt.Sprintf("workPackages[%v]", i)
+		problems = append(problems, rule.Condition.compile(key)...)
+		if rule.WorkPackage < 0 {
+			problems = append(problems, fmt.Sprintf("%v.workPackage has to be a positive number", key))
+		} else if rule.WorkPackage == 0 && (rule.noteRegex == nil || rule.noteRegex.NumSubexp() == 0) {
+			problems = append(problems, fmt.Sprintf(
+				"%v needs a workPackage or a note expression with a group that matches the id", key,
+			))
+		}
+	}
+	for i := range rules.WorkTypes {
+		rule := &rules.WorkTypes[i]
+		key := fmt.Sprintf("workTypes[%v]", i)
+		problems = append(problems, rule.Condition.compile(key)...)
+		if strings.TrimSpace(rule.WorkType) == "" {
+			problems = append(problems, key+".workType not set")
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("- %v", strings.Join(problems, "\n- "))
+	}
+	return nil
+}
+
+func (condition *Condition) compile(key string) []string {
+	var problems []string
+	if condition.Note == "" && condition.Project == "" && condition.Task == "" {
+		problems = append(problems, key+" needs at least one of note, project or task")
+	}
+	var err error
+	if condition.Note != "" {
+		condition.noteRegex, err = regexp.Compile(condition.Note)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%v.note is not a valid regular expression: %v", key, err))
+		}
+	}
+	if condition.Task != "" {
+		condition.taskRegex, err = regexp.Compile(condition.Task)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%v.task is not a valid regular expression: %v", key, err))
+		}
+	}
+	return problems
+}
+
+// matches checks the entry against the condition and returns the groups of the note expression
+func (condition *Condition) matches(entry tmetric.TimeEntry) (bool, []string) {
+	if condition.Project != "" && !strings.EqualFold(strings.TrimSpace(condition.Project), entry.Project.Name) {
+		return false, nil
+	}
+	if condition.taskRegex != nil && !condition.taskRegex.MatchString(entry.Task.Name) {
+		return false, nil
+	}
+	if condition.noteRegex == nil {
+		return true, nil
+	}
+	groups := condition.noteRegex.FindStringSubmatch(entry.Note)
+	return groups != nil, groups
+}
+
+// WorkPackageFor returns the id of the work package the first matching rule links the entry to
+func (rules *Rules) WorkPackageFor(entry tmetric.TimeEntry) (int, bool) {
+	if rules == nil {
+		return 0, false
+	}
+	for _, rule := range rules.WorkPackages {
+		matches, groups := rule.matches(entry)
+		if !matches {
+			continue
+		}
+		if rule.WorkPackage != 0 {
+			return rule.WorkPackage, true
+		}
+		workPackageId, err := strconv.Atoi(groups[1])
+		if err == nil && workPackageId > 0 {
+			return workPackageId, true
+		}
+	}
+	return 0, false
+}
+
+// WorkTypeFor returns the work type the first matching rule sets for the entry
+func (rules *Rules) WorkTypeFor(entry tmetric.TimeEntry) (string, bool) {
+	if rules == nil {
+		return "", false
+	}
+	for _, rule := range rules.WorkTypes {
+		if matches, _ := rule.matches(entry); matches {
+			return strings.TrimSpace(rule.WorkType), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,133 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/tmetric"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRules = `
+workPackages:
+  - note: '#(\d+)'
+  - note: 'OP-(\d+)'
+  - project: Support
+    task: '^Hotline'
+    workPackage: 42
+  - note: '(?i)standup'
+    workPackage: 7
+workTypes:
+  - project: Support
+    workType: Support
+  - note: '(?i)meeting|standup'
+    workType: Communication
+`
+
+func writeRules(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestRules_WorkPackageFor(t *testing.T) {
+	rules, err := Load(writeRules(t, testRules))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name                  string
+		entry                 tmetric.TimeEntry
+		expectedWorkPackageId int
+		expectedFound         bool
+	}{
+		{
+			name:                  "id in the note",
+			entry:                 tmetric.TimeEntry{Note: "fixed the login #1234"},
+			expectedWorkPackageId: 1234,
+			expectedFound:         true,
+		},
+		{
+			name:                  "id with a prefix in the note",
+			entry:                 tmetric.TimeEntry{Note: "OP-99: review"},
+			expectedWorkPackageId: 99,
+			expectedFound:         true,
+		},
+		{
+			name: "project and task",
+			entry: tmetric.TimeEntry{
+				Project: tmetric.Project{Name: "support"},
+				Task:    tmetric.Task{Name: "Hotline duty"},
+			},
+			expectedWorkPackageId: 42,
+			expectedFound:         true,
+		},
+		{
+			name: "project without the task",
+			entry: tmetric.TimeEntry{
+				Project: tmetric.Project{Name: "Support"},
+				Task:    tmetric.Task{Name: "Emails"},
+			},
+		},
+		{
+			name:                  "fixed work package",
+			entry:                 tmetric.TimeEntry{Note: "Daily Standup"},
+			expectedWorkPackageId: 7,
+			expectedFound:         true,
+		},
+		{
+			name:  "no rule matches",
+			entry: tmetric.TimeEntry{Note: "lunch"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workPackageId, found := rules.WorkPackageFor(tt.entry)
+			assert.Equal(t, tt.expectedFound, found)
+			assert.Equal(t, tt.expectedWorkPackageId, workPackageId)
+		})
+	}
+}
+
+func TestRules_WorkTypeFor(t *testing.T) {
+	rules, err := Load(writeRules(t, testRules))
+	assert.NoError(t, err)
+
+	workType, found := rules.WorkTypeFor(tmetric.TimeEntry{Project: tmetric.Project{Name: "Support"}, Note: "meeting"})
+	assert.True(t, found)
+	assert.Equal(t, "Support", workType)
+
+	workType, found = rules.WorkTypeFor(tmetric.TimeEntry{Note: "Team Meeting"})
+	assert.True(t, found)
+	assert.Equal(t, "Communication", workType)
+
+	_, found = rules.WorkTypeFor(tmetric.TimeEntry{Note: "coding"})
+	assert.False(t, found)
+
+	var noRules *Rules
+	_, found = noRules.WorkTypeFor(tmetric.TimeEntry{Note: "meeting"})
+	assert.False(t, found)
+}
+
+func TestLoad_invalidRules(t *testing.T) {
+	path := writeRules(t, `
+workPackages:
+  - workPackage: 1
+  - note: 'fix(('
+    workPackage: 2
+  - note: 'no group'
+workTypes:
+  - project: Support
+`)
+	_, err := Load(path)
+	assert.EqualError(t, err, "invalid rules file '"+path+"':\n"+
+		"- workPackages[0] needs at least one of note, project or task\n"+
+		"- workPackages[1].note is not a valid regular expression: "+
+		"error parsing regexp: missing closing ): `fix((`\n"+
+		"- workPackages[2] needs a workPackage or a note expression with a group that matches the id\n"+
+		"- workTypes[0].workType not set",
+	)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "could not read the rules file")
+}
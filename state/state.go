@@ -0,0 +1,207 @@
+/*
+Copyright © 2024 JankariTech Pvt. Ltd. info@jankaritech.com
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Transfer links a time entry in tmetric to the time entry that was created from it in OpenProject.
+// RunId is the id of the copy run that created the entry in OpenProject, it's empty if the entry existed already.
+// TagPending is set as long as the entry exists in OpenProject, but the tmetric entry is not tagged as transferred.
+// The note and the work package identify the tmetric entry if both its id and its start time were changed
+type Transfer struct {
+	RunId                string `json:"runId,omitempty"`
+	TmetricEntryId       int    `json:"tmetricEntryId"`
+	TmetricStartTime     string `json:"tmetricStartTime"`
+	TmetricNote          string `json:"tmetricNote,omitempty"`
+	WorkPackageId        int    `json:"workPackageId,omitempty"`
+	OpenProjectEntryId   int    `json:"openProjectEntryId"`
+	OpenProjectEntryHref string `json:"openProjectEntryHref"`
+	SpentOn              string `json:"spentOn"`
+	TransferredAt        string `json:"transferredAt"`
+	TagPending           bool   `json:"tagPending,omitempty"`
+}
+
+// Store keeps all transfers in a local JSON file. It's safe for concurrent use
+type Store struct {
+	mutex     sync.Mutex
+	path      string
+	Transfers []Transfer `json:"transfers"`
+}
+
+// Load reads the store from the given file. If the file does not exist yet an empty store is returned
+func Load(path string) (*Store, error) {
+	store := &Store{path: path}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read state file '%v': %v", path, err)
+	}
+	err = json.Unmarshal(content, store)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing state file '%v': %v", path, err)
+	}
+	return store, nil
+}
+
+// Record adds the transfer and writes the store to disk right away, so that the link survives even if the program
+// crashes later. An existing transfer of the same tmetric entry or of the same OpenProject entry gets replaced
+func (s *Store) Record(transfer Transfer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, existingTransfer := range s.Transfers {
+		if existingTransfer.TmetricEntryId == transfer.TmetricEntryId ||
+			(transfer.OpenProjectEntryId != 0 && existingTransfer.OpenProjectEntryId == transfer.OpenProjectEntryId) {
+			s.Transfers[i] = transfer
+			return s.save()
+		}
+	}
+	s.Transfers = append(s.Transfers, transfer)
+	return s.save()
+}
+
+// FindByTmetricEntry returns the transfer of the given tmetric entry.
+// tmetric assigns a new id to an entry when it is updated, so the start time is used as a fallback
+func (s *Store) FindByTmetricEntry(id int, startTime string) (Transfer, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, transfer := range s.Transfers {
+		if transfer.TmetricEntryId == id {
+			return transfer, true
+		}
+	}
+	for _, transfer := range s.Transfers {
+		if startTime != "" && transfer.TmetricStartTime == startTime {
+			return transfer, true
+		}
+	}
+	return Transfer{}, false
+}
+
+// TransfersOfSource returns the transfers of tmetric entries with the given note and work package.
+// Transfers that were recorded without them are never returned
+func (s *Store) TransfersOfSource(note string, workPackageId int) []Transfer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var transfers []Transfer
+	for _, transfer := range s.Transfers {
+		if transfer.WorkPackageId != 0 && transfer.WorkPackageId == workPackageId && transfer.TmetricNote == note {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers
+}
+
+// FindByOpenProjectEntry returns the transfer that created or linked the given OpenProject entry
+func (s *Store) FindByOpenProjectEntry(openProjectEntryId int) (Transfer, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, transfer := range s.Transfers {
+		if transfer.OpenProjectEntryId == openProjectEntryId {
+			return transfer, true
+		}
+	}
+	return Transfer{}, false
+}
+
+// Remove deletes the transfer of the given OpenProject entry from the store and writes the store to disk
+func (s *Store) Remove(openProjectEntryId int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, transfer := range s.Transfers {
+		if transfer.OpenProjectEntryId == openProjectEntryId {
+			s.Transfers = append(s.Transfers[:i], s.Transfers[i+1:]...)
+			return s.save()
+		}
+	}
+	return nil
+}
+
+// TransfersOfRun returns all transfers that were created by the copy run with the given id
+func (s *Store) TransfersOfRun(runId string) []Transfer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var transfers []Transfer
+	for _, transfer := range s.Transfers {
+		if transfer.RunId == runId {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers
+}
+
+// RunIds returns the ids of all copy runs that have transfers in the store, in the order they were recorded
+func (s *Store) RunIds() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var runIds []string
+	seen := map[string]bool{}
+	for _, transfer := range s.Transfers {
+		if transfer.RunId != "" && !seen[transfer.RunId] {
+			seen[transfer.RunId] = true
+			runIds = append(runIds, transfer.RunId)
+		}
+	}
+	return runIds
+}
+
+// TransfersSpentBetween returns all transfers of time spent between the two dates (format YYYY-MM-DD), including both
+func (s *Store) TransfersSpentBetween(startDate string, endDate string) []Transfer {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var transfers []Transfer
+	for _, transfer := range s.Transfers {
+		if transfer.SpentOn >= startDate && transfer.SpentOn <= endDate {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers
+}
+
+func (s *Store) save() error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling state to JSON: %v", err)
+	}
+	// write to a temporary file first, so that the existing state is not lost if writing fails half way
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not write state file '%v': %v", s.path, err)
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(content)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write state file '%v': %v", s.path, err)
+	}
+	err = os.Rename(tmpFile.Name(), s.path)
+	if err != nil {
+		return fmt.Errorf("could not write state file '%v': %v", s.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_notExistingFile(t *testing.T) {
+	store, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	assert.Empty(t, store.Transfers)
+}
+
+func TestLoad_invalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	_ = os.WriteFile(path, []byte("not json"), 0600)
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "error parsing state file")
+}
+
+func TestStore_RecordAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, _ := Load(path)
+	transfer := Transfer{
+		TmetricEntryId:       123,
+		TmetricStartTime:     "2024-01-31T10:10:20",
+		OpenProjectEntryId:   456,
+		OpenProjectEntryHref: "/api/v3/time_entries/456",
+		SpentOn:              "2024-01-31",
+		TransferredAt:        "2024-02-01T08:00:00Z",
+	}
+	err := store.Record(transfer)
+	assert.NoError(t, err)
+
+	// recording the same tmetric entry again replaces the first record
+	transfer.OpenProjectEntryId = 789
+	transfer.OpenProjectEntryHref = "/api/v3/time_entries/789"
+	err = store.Record(transfer)
+	assert.NoError(t, err)
+
+	// so does recording the same OpenProject entry for a tmetric entry that got a new id
+	transfer.TmetricEntryId = 124
+	err = store.Record(transfer)
+	assert.NoError(t, err)
+
+	loadedStore, err := Load(path)
+	assert.NoError(t, err)
+	if !reflect.DeepEqual(loadedStore.Transfers, []Transfer{transfer}) {
+		t.Errorf("got %v, want %v", loadedStore.Transfers, []Transfer{transfer})
+	}
+}
+
+func TestStore_FindByTmetricEntry(t *testing.T) {
+	store := &Store{Transfers: []Transfer{
+		{TmetricEntryId: 1, TmetricStartTime: "2024-01-31T08:00:00", OpenProjectEntryId: 10},
+		{TmetricEntryId: 2, TmetricStartTime: "2024-01-31T10:00:00", OpenProjectEntryId: 20},
+	}}
+	tests := []struct {
+		name      string
+		id        int
+		startTime string
+		wantId    int
+		wantFound bool
+	}{
+		{name: "found by id", id: 2, startTime: "2024-01-31T08:00:00", wantId: 20, wantFound: true},
+		{name: "found by start time", id: 3, startTime: "2024-01-31T08:00:00", wantId: 10, wantFound: true},
+		{name: "not found", id: 3, startTime: "2024-01-31T12:00:00", wantFound: false},
+		{name: "empty start time", id: 3, startTime: "", wantFound: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer, found := store.FindByTmetricEntry(tt.id, tt.startTime)
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.wantId, transfer.OpenProjectEntryId)
+		})
+	}
+}
+
+func TestStore_TransfersOfSource(t *testing.T) {
+	store := &Store{Transfers: []Transfer{
+		{TmetricEntryId: 1, TmetricNote: "fix bug", WorkPackageId: 12, OpenProjectEntryId: 10},
+		{TmetricEntryId: 2, TmetricNote: "fix bug", WorkPackageId: 13, OpenProjectEntryId: 20},
+		{TmetricEntryId: 3, TmetricNote: "fix bug", WorkPackageId: 12, OpenProjectEntryId: 30},
+		{TmetricEntryId: 4, OpenProjectEntryId: 40},
+	}}
+	assert.Equal(t, []Transfer{store.Transfers[0], store.Transfers[2]}, store.TransfersOfSource("fix bug", 12))
+	assert.Empty(t, store.TransfersOfSource("fix other bug", 12))
+	assert.Empty(t, store.TransfersOfSource("", 0))
+}
+
+func TestStore_FindByOpenProjectEntry(t *testing.T) {
+	store := &Store{Transfers: []Transfer{
+		{TmetricEntryId: 1, OpenProjectEntryId: 10},
+		{TmetricEntryId: 2, OpenProjectEntryId: 20},
+	}}
+	transfer, found := store.FindByOpenProjectEntry(20)
+	assert.True(t, found)
+	assert.Equal(t, 2, transfer.TmetricEntryId)
+
+	_, found = store.FindByOpenProjectEntry(30)
+	assert.False(t, found)
+}
+
+func TestStore_Remove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, _ := Load(path)
+	_ = store.Record(Transfer{TmetricEntryId: 1, OpenProjectEntryId: 10})
+	_ = store.Record(Transfer{TmetricEntryId: 2, OpenProjectEntryId: 20})
+
+	err := store.Remove(10)
+	assert.NoError(t, err)
+	err = store.Remove(30)
+	assert.NoError(t, err)
+
+	loadedStore, _ := Load(path)
+	assert.Equal(t, []Transfer{{TmetricEntryId: 2, OpenProjectEntryId: 20}}, loadedStore.Transfers)
+}
+
+func TestStore_TransfersSpentBetween(t *testing.T) {
+	store := &Store{Transfers: []Transfer{
+		{OpenProjectEntryId: 1, SpentOn: "2024-01-31"},
+		{OpenProjectEntryId: 2, SpentOn: "2024-02-01"},
+		{OpenProjectEntryId: 3, SpentOn: "2024-02-29"},
+		{OpenProjectEntryId: 4, SpentOn: "2024-03-01"},
+	}}
+	got := store.TransfersSpentBetween("2024-02-01", "2024-02-29")
+	assert.Equal(t, []Transfer{
+		{OpenProjectEntryId: 2, SpentOn: "2024-02-01"},
+		{OpenProjectEntryId: 3, SpentOn: "2024-02-29"},
+	}, got)
+}
+
+func TestStore_TransfersOfRun(t *testing.T) {
+	store := &Store{Transfers: []Transfer{
+		{RunId: "20240201T080000Z", OpenProjectEntryId: 1},
+		{RunId: "", OpenProjectEntryId: 2},
+		{RunId: "20240301T080000Z", OpenProjectEntryId: 3},
+		{RunId: "20240201T080000Z", OpenProjectEntryId: 4},
+	}}
+	assert.Equal(t, []Transfer{
+		{RunId: "20240201T080000Z", OpenProjectEntryId: 1},
+		{RunId: "20240201T080000Z", OpenProjectEntryId: 4},
+	}, store.TransfersOfRun("20240201T080000Z"))
+	assert.Empty(t, store.TransfersOfRun("does not exist"))
+	assert.Equal(t, []string{"20240201T080000Z", "20240301T080000Z"}, store.RunIds())
+}
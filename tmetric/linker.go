@@ -0,0 +1,292 @@
+package tmetric
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+)
+
+// leftoverDummyEntryDays is how many days back Linker.CleanUpDummyEntries searches for dummy entries
+const leftoverDummyEntryDays = 30
+
+// dummyEntryDeleteAttempts is how often the deletion of a dummy entry is tried before giving up
+const dummyEntryDeleteAttempts = 3
+
+// ErrTimerRunning is returned if a dummy entry cannot be created, because the user is tracking time.
+// Starting the dummy timer would stop the running timer of the user
+var ErrTimerRunning = errors.New(
+	"a timer is running in tmetric, stop it before linking time entries to OpenProject work packages",
+)
+
+// Linker links tmetric time entries to OpenProject work packages.
+// tmetric has no API to create an external task, so the task of an entry that is already linked to the
+// work package or the task that exists in the dummy project is reused. Only if there is none a dummy timer is started
+// for the work package, which creates the task, and the dummy entry is deleted right away
+type Linker struct {
+	config *config.Config
+	user   User
+	// tasks are the known external tasks by the id of the work package
+	tasks map[int]Task
+	// today returns the current day, it can be replaced in tests
+	today func() time.Time
+}
+
+func NewLinker(config *config.Config, user User) *Linker {
+	return &Linker{
+		config: config,
+		user:   user,
+		tasks:  map[int]Task{},
+		today:  time.Now,
+	}
+}
+
+// RememberTasks learns the external tasks of entries that are linked to OpenProject already, so they can be reused.
+// Tasks of other integrations, e.g. a GitHub issue with the same number, are ignored
+func (l *Linker) RememberTasks(timeEntries []TimeEntry) {
+	for _, entry := range timeEntries {
+		if entry.Task.Id == 0 || entry.Note == DummyTimeEntryNote || !l.isOpenProjectTask(entry.Task) {
+			continue
+		}
+		workPackageId, err := entry.GetIssueIdAsInt()
+		if err != nil {
+			continue
+		}
+		if _, known := l.tasks[workPackageId]; !known {
+			l.tasks[workPackageId] = entry.Task
+		}
+	}
+}
+
+// isOpenProjectTask tells if the task links to a work package of the OpenProject instance of the config
+func (l *Linker) isOpenProjectTask(task Task) bool {
+	return strings.HasPrefix(task.ExternalLink.Link, l.config.TmetricExternalTaskLink+"work_packages")
+}
+
+// Link assigns the external task of the work package to the entry and saves it in tmetric
+func (l *Linker) Link(entry *TimeEntry, workPackage openproject.WorkPackage) error {
+	task, err := l.TaskForWorkPackage(workPackage)
+	if err != nil {
+		return err
+	}
+	entry.Task = task
+	return entry.Update(*l.config, l.user)
+}
+
+// LinkAll links all the entries to the work package, the external task is created at most once.
+// An entry that cannot be updated does not stop the others, all failures are returned together
+func (l *Linker) LinkAll(entries []TimeEntry, workPackage openproject.WorkPackage) error {
+	task, err := l.TaskForWorkPackage(workPackage)
+	if err != nil {
+		return err
+	}
+	var updateErrors []error
+	for i := range entries {
+		entries[i].Task = task
+		err = entries[i].Update(*l.config, l.user)
+		if err != nil {
+			updateErrors = append(updateErrors, fmt.Errorf("entry '%v': %v", entries[i].Note, err))
+		}
+	}
+	return errors.Join(updateErrors...)
+}
+
+// TaskForWorkPackage returns the external task of the work package, if needed it's created with a dummy entry
+func (l *Linker) TaskForWorkPackage(workPackage openproject.WorkPackage) (Task, error) {
+	if task, known := l.tasks[workPackage.Id]; known {
+		return task, nil
+	}
+	// the task might have been created before for entries that are not in the period that is checked
+	task, found, err := l.findTask(workPackage)
+	if err != nil {
+		return Task{}, err
+	}
+	if !found {
+		task, err = l.createTask(workPackage)
+		if err != nil {
+			return Task{}, err
+		}
+	}
+	l.tasks[workPackage.Id] = task
+	return task, nil
+}
+
+// findTask looks for the external task of the work package in the dummy project, that's where createTask creates them
+func (l *Linker) findTask(workPackage openproject.WorkPackage) (Task, bool, error) {
+	httpClient := newHttpClient(*l.config)
+	resp, err := httpClient.R().
+		SetQueryParam("projectId", strconv.Itoa(l.config.TmetricDummyProjectId)).
+		Get(fmt.Sprintf(
+			`%vaccounts/%v/tasks`,
+			l.config.TmetricAPIV3BaseUrl,
+			l.user.ActiveAccountId,
+		))
+	if err != nil || resp.StatusCode() != 200 {
+		return Task{}, false, fmt.Errorf(
+			"could not read the tasks of the dummy project in tmetric. Error : '%v'. HTTP-Status-Code: %v",
+			err, resp.StatusCode(),
+		)
+	}
+	var tasks []Task
+	err = json.Unmarshal(resp.Body(), &tasks)
+	if err != nil {
+		return Task{}, false, fmt.Errorf("error parsing tasks response: %v", err)
+	}
+	issueId := fmt.Sprintf("#%v", workPackage.Id)
+	for _, task := range tasks {
+		if task.Id != 0 && task.ExternalLink.IssueId == issueId && l.isOpenProjectTask(task) {
+			return task, true, nil
+		}
+	}
+	return Task{}, false, nil
+}
+
+// dateRange returns the days around today as start and end date for the API,
+// so that the dummy entries are found whatever timezone tmetric uses
+func (l *Linker) dateRange(daysBack int) (string, string) {
+	today := l.today()
+	return today.AddDate(0, 0, -daysBack).Format("2006-01-02"), today.AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+// checkNoTimerRunning returns ErrTimerRunning if the latest entry of the user is still running.
+// A running dummy entry is a leftover and is not counted
+func (l *Linker) checkNoTimerRunning() error {
+	httpClient := newHttpClient(*l.config)
+	resp, err := httpClient.R().
+		SetQueryString("userId=" + strconv.Itoa(l.user.Id)).
+		Get(
+			fmt.Sprintf(
+				`%vaccounts/%v/timeentries/latest`,
+				l.config.TmetricAPIV3BaseUrl,
+				l.user.ActiveAccountId,
+			),
+		)
+	if err != nil || resp.StatusCode() != 200 {
+		return fmt.Errorf(
+			"could not find latest time entry. Error : '%v'. HTTP-Status-Code: %v",
+			err, resp.StatusCode(),
+		)
+	}
+	// there is no content if the user has no entries at all
+	if len(resp.Body()) == 0 {
+		return nil
+	}
+	latestTimeEntry := TimeEntry{}
+	err = json.Unmarshal(resp.Body(), &latestTimeEntry)
+	if err != nil {
+		return fmt.Errorf("error parsing latest time entry: %v", err)
+	}
+	if latestTimeEntry.Id != 0 && latestTimeEntry.EndTime == "" && latestTimeEntry.Note != DummyTimeEntryNote {
+		return ErrTimerRunning
+	}
+	return nil
+}
+
+// createTask starts a dummy timer for the work package and reads the task that tmetric created for it.
+// The dummy entry is always deleted before returning, also if anything failed after the timer was started
+func (l *Linker) createTask(workPackage openproject.WorkPackage) (task Task, err error) {
+	err = l.checkNoTimerRunning()
+	if err != nil {
+		return Task{}, err
+	}
+
+	dummyTimeEntry := NewDummyTimeEntry(workPackage, l.config.TmetricExternalTaskLink, l.config.TmetricDummyProjectId)
+	dummyTimerString, _ := json.Marshal(dummyTimeEntry)
+	httpClient := newHttpClient(*l.config)
+	resp, err := httpClient.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(dummyTimerString).
+		Post(fmt.Sprintf(
+			`%vaccounts/%v/timer/issue`,
+			l.config.TmetricAPIBaseUrl,
+			l.user.ActiveAccountId,
+		))
+	defer func() {
+		// even if the request failed the timer might have been started
+		_, cleanupErr := l.deleteDummyEntries(0)
+		if cleanupErr != nil {
+			err = errors.Join(err, cleanupErr)
+		}
+	}()
+	if err != nil || resp.StatusCode() != 200 {
+		return Task{}, fmt.Errorf(
+			"could not create dummy time entry. Is 'tmetric.dummyProjectId' set correctly in the config?\n"+
+				"Error : '%v'. HTTP-Status-Code: %v",
+			err, resp.StatusCode(),
+		)
+	}
+
+	dummyEntries, err := l.findDummyEntries(0)
+	if err != nil {
+		return Task{}, err
+	}
+	issueId := fmt.Sprintf("#%v", workPackage.Id)
+	for _, entry := range dummyEntries {
+		if entry.Task.Id != 0 && entry.Task.ExternalLink.IssueId == issueId {
+			return entry.Task, nil
+		}
+	}
+	return Task{}, fmt.Errorf("could not find the dummy time entry of the work package %v in tmetric", issueId)
+}
+
+// findDummyEntries returns all dummy entries of the user from the given number of days back till tomorrow
+func (l *Linker) findDummyEntries(daysBack int) ([]TimeEntry, error) {
+	startDate, endDate := l.dateRange(daysBack)
+	timeEntries, err := GetTimeEntriesOfAllClients(l.config, l.user, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	var dummyEntries []TimeEntry
+	for _, entry := range timeEntries {
+		if entry.Note == DummyTimeEntryNote {
+			dummyEntries = append(dummyEntries, entry)
+		}
+	}
+	return dummyEntries, nil
+}
+
+// deleteDummyEntries deletes the dummy entries of the given number of days back till tomorrow,
+// and checks that they are really gone. It returns the number of deleted entries
+func (l *Linker) deleteDummyEntries(daysBack int) (int, error) {
+	deleted := 0
+	var deleteErr error
+	for attempt := 0; ; attempt++ {
+		dummyEntries, err := l.findDummyEntries(daysBack)
+		if err != nil {
+			return deleted, fmt.Errorf("could not check for dummy time entries: %v", err)
+		}
+		if len(dummyEntries) == 0 {
+			return deleted, nil
+		}
+		if attempt == dummyEntryDeleteAttempts {
+			break
+		}
+		for _, entry := range dummyEntries {
+			err = entry.Delete(*l.config, l.user)
+			if err != nil {
+				deleteErr = err
+				continue
+			}
+			deleted++
+		}
+	}
+	message := fmt.Sprintf(
+		"could not delete the time entries with the note '%v' in tmetric, please delete them manually",
+		DummyTimeEntryNote,
+	)
+	if deleteErr != nil {
+		message += fmt.Sprintf(": %v", deleteErr)
+	}
+	return deleted, errors.New(message)
+}
+
+// CleanUpDummyEntries deletes dummy entries that were left over, e.g. because an earlier run was interrupted.
+// It returns the number of deleted entries
+func (l *Linker) CleanUpDummyEntries() (int, error) {
+	return l.deleteDummyEntries(leftoverDummyEntryDays)
+}
@@ -0,0 +1,234 @@
+package tmetric
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockTmetric keeps the time entries of one user and acts like the parts of the API the linker uses
+type mockTmetric struct {
+	entries         []TimeEntry
+	tasks           []Task
+	taskRequests    []string
+	latest          string
+	failTimer       bool
+	failDelete      bool
+	timerRequests   int
+	deleteRequests  int
+	createdEntryIds int
+	// failUpdateIds are the entries that cannot be updated
+	failUpdateIds map[int]bool
+}
+
+func (m *mockTmetric) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/timeentries/latest"):
+		w.Write([]byte(m.latest))
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/timeentries"):
+		body, _ := json.Marshal(m.entries)
+		w.Write(body)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/tasks"):
+		m.taskRequests = append(m.taskRequests, r.URL.RequestURI())
+		body, _ := json.Marshal(m.tasks)
+		w.Write(body)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/timer/issue"):
+		m.timerRequests++
+		var dummy DummyTimeEntry
+		_ = json.NewDecoder(r.Body).Decode(&dummy)
+		m.createdEntryIds++
+		// the timer is started even if the response is an error
+		m.entries = append(m.entries, TimeEntry{
+			Id:   100 + m.createdEntryIds,
+			Note: dummy.Description,
+			Task: Task{Id: 500, Name: dummy.IssueName, ExternalLink: ExternalLink{IssueId: dummy.IssueId}},
+		})
+		if m.failTimer {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	case r.Method == http.MethodPut:
+		var updated TimeEntry
+		_ = json.NewDecoder(r.Body).Decode(&updated)
+		if m.failUpdateIds[updated.Id] {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for i, entry := range m.entries {
+			if entry.Id == updated.Id {
+				m.entries[i] = updated
+			}
+		}
+	case r.Method == http.MethodDelete:
+		m.deleteRequests++
+		if m.failDelete {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		id, _ := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		for i, entry := range m.entries {
+			if entry.Id == id {
+				m.entries = append(m.entries[:i], m.entries[i+1:]...)
+				break
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestLinker(mock *mockTmetric) (*Linker, *httptest.Server) {
+	mockServer := httptest.NewServer(mock)
+	config := config.Config{
+		TmetricToken:            "dummyToken",
+		TmetricAPIBaseUrl:       mockServer.URL + "/",
+		TmetricAPIV3BaseUrl:     mockServer.URL + "/v3/",
+		TmetricDummyProjectId:   7,
+		TmetricExternalTaskLink: "https://op.example.com/",
+	}
+	linker := NewLinker(&config, User{Id: 1, ActiveAccountId: 2})
+	linker.today = func() time.Time { return time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC) }
+	return linker, mockServer
+}
+
+func TestLinker_TaskForWorkPackage(t *testing.T) {
+	workPackage := openproject.WorkPackage{Id: 1234, Subject: "Fix the bug"}
+
+	t.Run("reuses the task of a linked entry", func(t *testing.T) {
+		mock := &mockTmetric{}
+		linker, mockServer := newTestLinker(mock)
+		defer mockServer.Close()
+		existingTask := Task{
+			Id:           42,
+			ExternalLink: ExternalLink{IssueId: "#1234", Link: "https://op.example.com/work_packages/1234"},
+		}
+		linker.RememberTasks([]TimeEntry{{Id: 1, Task: existingTask}})
+
+		task, err := linker.TaskForWorkPackage(workPackage)
+		assert.NoError(t, err)
+		assert.Equal(t, existingTask, task)
+		assert.Equal(t, 0, mock.timerRequests)
+	})
+
+	t.Run("does not reuse the task of another integration", func(t *testing.T) {
+		mock := &mockTmetric{}
+		linker, mockServer := newTestLinker(mock)
+		defer mockServer.Close()
+		gitHubTask := Task{
+			Id:           43,
+			ExternalLink: ExternalLink{IssueId: "#1234", Link: "https://github.com/owner/repo/issues/1234"},
+		}
+		linker.RememberTasks([]TimeEntry{{Id: 1, Task: gitHubTask}})
+
+		task, err := linker.TaskForWorkPackage(workPackage)
+		assert.NoError(t, err)
+		assert.NotEqual(t, gitHubTask, task)
+		assert.Equal(t, 1, mock.timerRequests)
+	})
+
+	t.Run("reuses the task that exists in the dummy project", func(t *testing.T) {
+		existingTask := Task{
+			Id:           44,
+			ExternalLink: ExternalLink{IssueId: "#1234", Link: "https://op.example.com/work_packages/1234"},
+		}
+		mock := &mockTmetric{tasks: []Task{
+			{Id: 43, ExternalLink: ExternalLink{IssueId: "#1234", Link: "https://github.com/owner/repo/issues/1234"}},
+			{Id: 45, ExternalLink: ExternalLink{IssueId: "#123", Link: "https://op.example.com/work_packages/123"}},
+			existingTask,
+		}}
+		linker, mockServer := newTestLinker(mock)
+		defer mockServer.Close()
+
+		task, err := linker.TaskForWorkPackage(workPackage)
+		assert.NoError(t, err)
+		assert.Equal(t, existingTask, task)
+		assert.Equal(t, 0, mock.timerRequests)
+		assert.Equal(t, []string{"/v3/accounts/2/tasks?projectId=7"}, mock.taskRequests)
+	})
+
+	t.Run("creates the task with a dummy entry that is deleted", func(t *testing.T) {
+		mock := &mockTmetric{latest: `{"id":1,"startTime":"2024-05-10T08:00:00","endTime":"2024-05-10T09:00:00"}`}
+		linker, mockServer := newTestLinker(mock)
+		defer mockServer.Close()
+
+		task, err := linker.TaskForWorkPackage(workPackage)
+		assert.NoError(t, err)
+		assert.Equal(t, "#1234", task.ExternalLink.IssueId)
+		assert.Empty(t, mock.entries)
+
+		// the second time the task is known already
+		_, err = linker.TaskForWorkPackage(workPackage)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, mock.timerRequests)
+	})
+
+	t.Run("does not stop a running timer", func(t *testing.T) {
+		mock := &mockTmetric{latest: `{"id":1,"startTime":"2024-05-10T08:00:00","endTime":null}`}
+		linker, mockServer := newTestLinker(mock)
+		defer mockServer.Close()
+
+		_, err := linker.TaskForWorkPackage(workPackage)
+		assert.ErrorIs(t, err, ErrTimerRunning)
+		assert.Equal(t, 0, mock.timerRequests)
+	})
+
+	t.Run("deletes the dummy entry if the timer request failed", func(t *testing.T) {
+		mock := &mockTmetric{failTimer: true}
+		linker, mockServer := newTestLinker(mock)
+		defer mockServer.Close()
+
+		_, err := linker.TaskForWorkPackage(workPackage)
+		assert.ErrorContains(t, err, "could not create dummy time entry")
+		assert.Empty(t, mock.entries)
+	})
+
+	t.Run("reports a dummy entry that cannot be deleted", func(t *testing.T) {
+		mock := &mockTmetric{failDelete: true}
+		linker, mockServer := newTestLinker(mock)
+		defer mockServer.Close()
+
+		_, err := linker.TaskForWorkPackage(workPackage)
+		assert.ErrorContains(t, err, "please delete them manually")
+		assert.Equal(t, dummyEntryDeleteAttempts, mock.deleteRequests)
+	})
+}
+
+func TestLinker_LinkAll(t *testing.T) {
+	mock := &mockTmetric{
+		entries:       []TimeEntry{{Id: 1, Note: "weekly"}, {Id: 2, Note: "weekly"}, {Id: 3, Note: "Weekly"}},
+		failUpdateIds: map[int]bool{2: true},
+	}
+	linker, mockServer := newTestLinker(mock)
+	defer mockServer.Close()
+	entries := append([]TimeEntry{}, mock.entries...)
+
+	err := linker.LinkAll(entries, openproject.WorkPackage{Id: 1234, Subject: "Meetings"})
+	assert.EqualError(t, err, "entry 'weekly': could not update time entry. Error: '<nil>'. HTTP status code: 500")
+	// one dummy entry for all the entries
+	assert.Equal(t, 1, mock.timerRequests)
+	assert.Equal(t, "#1234", mock.entries[0].Task.ExternalLink.IssueId)
+	assert.Equal(t, "", mock.entries[1].Task.ExternalLink.IssueId)
+	assert.Equal(t, "#1234", mock.entries[2].Task.ExternalLink.IssueId)
+}
+
+func TestLinker_CleanUpDummyEntries(t *testing.T) {
+	mock := &mockTmetric{entries: []TimeEntry{
+		{Id: 1, Note: "real work"},
+		{Id: 2, Note: DummyTimeEntryNote},
+		{Id: 3, Note: DummyTimeEntryNote},
+	}}
+	linker, mockServer := newTestLinker(mock)
+	defer mockServer.Close()
+
+	deleted, err := linker.CleanUpDummyEntries()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.Equal(t, []TimeEntry{{Id: 1, Note: "real work"}}, mock.entries)
+}
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
-	"github.com/go-resty/resty/v2"
 )
 
 type ReportItem struct {
@@ -81,7 +80,7 @@ func GetDetailedReport(
 		projectsIds = append(projectsIds, strconv.Itoa(project.Id))
 	}
 
-	httpClient := resty.New()
+	httpClient := newHttpClient(*config)
 	tmetricUrl, _ := url.JoinPath(config.TmetricAPIBaseUrl, "reports/detailed")
 	request := httpClient.R()
 
@@ -98,7 +97,6 @@ func GetDetailedReport(
 	endDate = endTime.AddDate(0, 0, 1).Format("2006-01-02")
 
 	resp, err := request.
-		SetAuthToken(config.TmetricToken).
 		SetQueryParam("AccountId", strconv.Itoa(tmetricUser.ActiveAccountId)).
 		SetQueryParam("ClientList", strconv.Itoa(client.Id)).
 		SetQueryParam("GroupList", strconv.Itoa(team.Id)).
@@ -22,8 +22,8 @@ import (
 	"fmt"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
-	"github.com/go-resty/resty/v2"
 	"regexp"
+	"slices"
 	"strconv"
 	"time"
 )
@@ -67,6 +67,9 @@ type TimeEntry struct {
 	Tags      []Tag   `json:"tags"`
 }
 
+// DummyTimeEntryNote is the note of the entries that are only created to create an external task
+const DummyTimeEntryNote = "to-delete-only-created-to-create-an-external-task"
+
 type DummyTimeEntry struct {
 	IsStarted   bool   `json:"isStarted"`
 	ShowIssueId bool   `json:"showIssueId"`
@@ -91,15 +94,14 @@ func NewDummyTimeEntry(workPackage openproject.WorkPackage, openProjectUrl strin
 		IssueUrl:    fmt.Sprintf("/work_packages/%v", workPackage.Id),
 		ServiceUrl:  openProjectUrl,
 		ServiceType: "OpenProject",
-		Description: "to-delete-only-created-to-create-an-external-task",
+		Description: DummyTimeEntryNote,
 		ProjectId:   projectId,
 	}
 }
 
 func (timeEntry *TimeEntry) Delete(config config.Config, user User) error {
-	httpClient := resty.New()
-	_, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
+	httpClient := newHttpClient(config)
+	resp, err := httpClient.R().
 		Delete(
 			fmt.Sprintf(
 				`%vaccounts/%v/timeentries/%v`,
@@ -108,17 +110,23 @@ func (timeEntry *TimeEntry) Delete(config config.Config, user User) error {
 				timeEntry.Id,
 			),
 		)
-	return err
+	if err != nil || resp.IsError() {
+		return fmt.Errorf(
+			"could not delete time entry %v. Error: '%v'. HTTP status code: %v", timeEntry.Id, err, resp.StatusCode(),
+		)
+	}
+	return nil
 }
 
+// Update saves the entry in tmetric. tmetric assigns a new id to an entry when it is updated,
+// so the id of the entry is changed to the one in the response
 func (timeEntry *TimeEntry) Update(config config.Config, user User) error {
 	entryJSON, err := json.Marshal(timeEntry)
 	if err != nil {
 		return fmt.Errorf("error marshalling tmetric entry to JSON: %v", err)
 	}
-	httpClient := resty.New()
+	httpClient := newHttpClient(config)
 	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
 		SetHeader("Content-Type", "application/json").
 		SetBody(entryJSON).
 		Put(
@@ -135,14 +143,24 @@ func (timeEntry *TimeEntry) Update(config config.Config, user User) error {
 			"could not update time entry. Error: '%v'. HTTP status code: %v", err, resp.StatusCode(),
 		)
 	}
+	if len(resp.Body()) == 0 {
+		return nil
+	}
+	var updatedEntry TimeEntry
+	err = json.Unmarshal(resp.Body(), &updatedEntry)
+	if err != nil {
+		return fmt.Errorf("time entry was updated, but the response could not be parsed: %v", err)
+	}
+	if updatedEntry.Id != 0 {
+		timeEntry.Id = updatedEntry.Id
+	}
 	return nil
 }
 
 func (timeEntry *TimeEntry) GetPossibleWorkTypes(config config.Config, user User) ([]Tag, error) {
-	httpClient := resty.New()
+	httpClient := newHttpClient(config)
 
 	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParam("projectId", strconv.Itoa(timeEntry.Project.Id)).
 		Get(fmt.Sprintf(
@@ -188,60 +206,20 @@ func (timeEntry *TimeEntry) GetIssueIdAsInt() (int, error) {
 	return strconv.Atoi(issueIdStr[1])
 }
 
-/*
-this is the only way to create an external task in tmetric.
-This task is needed to have an issueId of OpenProject assigned to a time entry.
-*/
-func CreateDummyTimeEntry(
-	workPackage openproject.WorkPackage, tmetricUser User, config *config.Config,
-) (*TimeEntry, error) {
-	dummyTimeEntry := NewDummyTimeEntry(workPackage, config.OpenProjectUrl, config.TmetricDummyProjectId)
-	dummyTimeEntry.ServiceUrl = config.TmetricExternalTaskLink
-	dummyTimerString, _ := json.Marshal(dummyTimeEntry)
-	httpClient := resty.New()
-	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
-		SetHeader("Content-Type", "application/json").
-		SetBody(dummyTimerString).
-		Post(fmt.Sprintf(
-			`%vaccounts/%v/timer/issue`,
-			config.TmetricAPIBaseUrl,
-			tmetricUser.ActiveAccountId,
-		))
-	if err != nil || resp.StatusCode() != 200 {
-		return nil, fmt.Errorf(
-			"could not create dummy time entry. Is 'tmetric.dummyProjectId' set correctly in the config?\n"+
-				"Error : '%v'. HTTP-Status-Code: %v",
-			err, resp.StatusCode(),
-		)
-	}
+var workPackageReferenceRegex = regexp.MustCompile(`(?:^|[^\w&])#(\d+)\b`)
 
-	resp, err = httpClient.R().
-		SetAuthToken(config.TmetricToken).
-		SetQueryString("userId=" + strconv.Itoa(tmetricUser.Id)).
-		Get(
-			fmt.Sprintf(
-				`%vaccounts/%v/timeentries/latest`,
-				config.TmetricAPIV3BaseUrl,
-				tmetricUser.ActiveAccountId,
-			),
-		)
-
-	if err != nil || resp.StatusCode() != 200 {
-		return nil, fmt.Errorf(
-			"could not find latest time entry. Error : '%v'. HTTP-Status-Code: %v",
-			err, resp.StatusCode(),
-		)
-	}
-	latestTimeEntry := TimeEntry{}
-	err = json.Unmarshal(resp.Body(), &latestTimeEntry)
-
-	if err != nil || latestTimeEntry.Note != "to-delete-only-created-to-create-an-external-task" {
-		return nil, fmt.Errorf(
-			"could not find dummy time entry",
-		)
+// GetWorkPackageReferencesInNote returns the ids of the work packages that are mentioned in the note like '#1234',
+// in the order they appear and without duplicates
+func (timeEntry *TimeEntry) GetWorkPackageReferencesInNote() []int {
+	var workPackageIds []int
+	for _, match := range workPackageReferenceRegex.FindAllStringSubmatch(timeEntry.Note, -1) {
+		workPackageId, err := strconv.Atoi(match[1])
+		if err != nil || workPackageId == 0 || slices.Contains(workPackageIds, workPackageId) {
+			continue
+		}
+		workPackageIds = append(workPackageIds, workPackageId)
 	}
-	return &latestTimeEntry, nil
+	return workPackageIds
 }
 
 func (timeEntry *TimeEntry) GetWorkType() (string, error) {
@@ -340,3 +318,14 @@ func (timeEntry *TimeEntry) GetHumanReadableDuration() (string, error) {
 func (timeEntry *TimeEntry) TagAsTransferredToOpenProject(config config.Config) {
 	timeEntry.Tags = append(timeEntry.Tags, Tag{Name: config.TmetricTagTransferredToOpenProject})
 }
+
+// RemoveTagTransferredToOpenProject removes the tag, so that the entry gets transferred again by the next copy
+func (timeEntry *TimeEntry) RemoveTagTransferredToOpenProject(config config.Config) {
+	var tags []Tag
+	for _, tag := range timeEntry.Tags {
+		if tag.Name != config.TmetricTagTransferredToOpenProject {
+			tags = append(tags, tag)
+		}
+	}
+	timeEntry.Tags = tags
+}
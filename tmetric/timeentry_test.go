@@ -1,7 +1,10 @@
 package tmetric
 
 import (
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -99,3 +102,73 @@ func Test_getIso8601Duration(t *testing.T) {
 		})
 	}
 }
+
+func TestTimeEntry_Update(t *testing.T) {
+	tests := []struct {
+		name         string
+		mockResponse string
+		wantId       int
+	}{
+		{
+			name:         "tmetric assigns a new id",
+			mockResponse: `{"id":5678,"note":"coding"}`,
+			wantId:       5678,
+		},
+		{
+			name:         "empty response keeps the id",
+			mockResponse: ``,
+			wantId:       1234,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestPath string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestPath = r.URL.Path
+				w.Write([]byte(tt.mockResponse))
+			}))
+			defer mockServer.Close()
+			config := config.Config{TmetricToken: "dummyToken", TmetricAPIV3BaseUrl: mockServer.URL + "/"}
+
+			timeEntry := TimeEntry{Id: 1234, Note: "coding"}
+			err := timeEntry.Update(config, User{ActiveAccountId: 8888})
+			assert.NoError(t, err)
+			assert.Equal(t, "/accounts/8888/timeentries/1234", requestPath)
+			assert.Equal(t, tt.wantId, timeEntry.Id)
+		})
+	}
+}
+
+func TestTimeEntry_TagAsTransferredToOpenProject(t *testing.T) {
+	config := config.Config{TmetricTagTransferredToOpenProject: "transferred-to-openproject"}
+	timeEntry := TimeEntry{
+		Tags: []Tag{{Id: 1, Name: "Development", IsWorkType: true}},
+	}
+	timeEntry.TagAsTransferredToOpenProject(config)
+	assert.Equal(t, []Tag{
+		{Id: 1, Name: "Development", IsWorkType: true},
+		{Name: "transferred-to-openproject"},
+	}, timeEntry.Tags)
+
+	timeEntry.RemoveTagTransferredToOpenProject(config)
+	assert.Equal(t, []Tag{{Id: 1, Name: "Development", IsWorkType: true}}, timeEntry.Tags)
+}
+
+func TestTimeEntry_GetWorkPackageReferencesInNote(t *testing.T) {
+	tests := []struct {
+		note     string
+		expected []int
+	}{
+		{note: "fixing #4711 login bug", expected: []int{4711}},
+		{note: "#12 and #34, then #12 again", expected: []int{12, 34}},
+		{note: "(#56)", expected: []int{56}},
+		{note: "no reference", expected: nil},
+		{note: "issue#78 or &#39; or #0 or #9x", expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.note, func(t *testing.T) {
+			timeEntry := TimeEntry{Note: tt.note}
+			assert.Equal(t, tt.expected, timeEntry.GetWorkPackageReferencesInNote())
+		})
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/httpclient"
 	"github.com/go-resty/resty/v2"
 )
 
@@ -39,13 +41,17 @@ type Team struct {
 	Id   int    `json:"id"`
 }
 
+// newHttpClient returns a client that is authenticated against tmetric
+func newHttpClient(config config.Config) *resty.Client {
+	return httpclient.New(config).SetAuthToken(config.TmetricToken)
+}
+
 func GetAllTeams(config *config.Config, tmetricUser User) ([]Team, error) {
-	httpClient := resty.New()
+	httpClient := newHttpClient(*config)
 	tmetricUrl, _ := url.JoinPath(
 		config.TmetricAPIV3BaseUrl, "accounts/", strconv.Itoa(tmetricUser.ActiveAccountId), "/teams/managed",
 	)
 	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
 		Get(tmetricUrl)
 	if err != nil || resp.StatusCode() != 200 {
 		return nil, fmt.Errorf(
@@ -73,13 +79,12 @@ func getTeamByName(config *config.Config, tmetricUser User, name string) (Team,
 	return Team{}, fmt.Errorf("could not find any team with name '%v'", name)
 }
 
-func getAllProjects(config *config.Config, tmetricUser User) ([]ProjectV2, error) {
-	httpClient := resty.New()
+func GetAllProjects(config *config.Config, tmetricUser User) ([]ProjectV2, error) {
+	httpClient := newHttpClient(*config)
 	tmetricUrl, _ := url.JoinPath(
 		config.TmetricAPIBaseUrl, "accounts/", strconv.Itoa(tmetricUser.ActiveAccountId), "/projects",
 	)
 	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
 		Get(tmetricUrl)
 	if err != nil || resp.StatusCode() != 200 {
 		return nil, fmt.Errorf(
@@ -95,7 +100,7 @@ func getAllProjects(config *config.Config, tmetricUser User) ([]ProjectV2, error
 }
 
 func getProjectByName(config *config.Config, tmetricUser User, name string) (ProjectV2, error) {
-	projects, err := getAllProjects(config, tmetricUser)
+	projects, err := GetAllProjects(config, tmetricUser)
 	if err != nil {
 		return ProjectV2{}, err
 	}
@@ -107,35 +112,47 @@ func getProjectByName(config *config.Config, tmetricUser User, name string) (Pro
 	return ProjectV2{}, fmt.Errorf("could not find any project in tmetric with name '%v'", name)
 }
 
-func GetAllWorkTypes(config *config.Config, tmetricUser User) ([]Tag, error) {
-	httpClient := resty.New()
+// GetAllTags returns all tags of the account, work types included
+func GetAllTags(config *config.Config, tmetricUser User) ([]Tag, error) {
+	httpClient := newHttpClient(*config)
 	tmetricUrl, _ := url.JoinPath(
 		config.TmetricAPIBaseUrl, "accounts/", strconv.Itoa(tmetricUser.ActiveAccountId), "/tags",
 	)
 	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
 		Get(tmetricUrl)
 	if err != nil || resp.StatusCode() != 200 {
 		return nil, fmt.Errorf(
 			"cannot read tags from tmetric. Error: '%v'. HTTP status code: %v", err, resp.StatusCode(),
 		)
 	}
-	var tags []TagV2
-	err = json.Unmarshal(resp.Body(), &tags)
+	var tagsV2 []TagV2
+	err = json.Unmarshal(resp.Body(), &tagsV2)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing tags response: %v\n", err)
 	}
+	var tags []Tag
+	for _, tag := range tagsV2 {
+		tags = append(tags, Tag{
+			Id:         tag.Id,
+			Name:       tag.Name,
+			IsWorkType: tag.IsWorkType,
+		})
+	}
+	return tags, nil
+}
+
+func GetAllWorkTypes(config *config.Config, tmetricUser User) ([]Tag, error) {
+	tags, err := GetAllTags(config, tmetricUser)
+	if err != nil {
+		return nil, err
+	}
 	var workTypes []Tag
 	for _, tag := range tags {
 		if tag.IsWorkType {
-			workTypes = append(workTypes, Tag{
-				Id:         tag.Id,
-				Name:       tag.Name,
-				IsWorkType: tag.IsWorkType,
-			})
+			workTypes = append(workTypes, tag)
 		}
 	}
-	return workTypes, err
+	return workTypes, nil
 }
 
 func getWorkTypeByName(config *config.Config, tmetricUser User, name string) (Tag, error) {
@@ -151,23 +168,30 @@ func getWorkTypeByName(config *config.Config, tmetricUser User, name string) (Ta
 	return Tag{}, fmt.Errorf("could not find any work type with name '%v'", name)
 }
 
-func getClientByName(config *config.Config, tmetricUser User, name string) (Client, error) {
-	httpClient := resty.New()
+func GetAllClients(config *config.Config, tmetricUser User) ([]ClientV2, error) {
+	httpClient := newHttpClient(*config)
 	tmetricUrl, _ := url.JoinPath(
 		config.TmetricAPIBaseUrl, "accounts/", strconv.Itoa(tmetricUser.ActiveAccountId), "/clients",
 	)
 	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
 		Get(tmetricUrl)
 	if err != nil || resp.StatusCode() != 200 {
-		return Client{}, fmt.Errorf(
+		return nil, fmt.Errorf(
 			"cannot read clients from tmetric. Error: '%v'. HTTP status code: %v", err, resp.StatusCode(),
 		)
 	}
 	var clients []ClientV2
 	err = json.Unmarshal(resp.Body(), &clients)
 	if err != nil {
-		return Client{}, fmt.Errorf("error parsing clients response: %v\n", err)
+		return nil, fmt.Errorf("error parsing clients response: %v\n", err)
+	}
+	return clients, nil
+}
+
+func getClientByName(config *config.Config, tmetricUser User, name string) (Client, error) {
+	clients, err := GetAllClients(config, tmetricUser)
+	if err != nil {
+		return Client{}, err
 	}
 	for _, client := range clients {
 		if client.Name == name {
@@ -181,9 +205,25 @@ func getClientByName(config *config.Config, tmetricUser User, name string) (Clie
 }
 
 func GetAllTimeEntries(config *config.Config, tmetricUser User, startDate string, endDate string) ([]TimeEntry, error) {
-	httpClient := resty.New()
+	timeEntries, err := GetTimeEntriesOfAllClients(config, tmetricUser, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	selectedTimeEntries := selectTimeEntries(config, timeEntries)
+	sort.Slice(selectedTimeEntries, func(i, j int) bool {
+		return selectedTimeEntries[i].StartTime < selectedTimeEntries[j].StartTime
+	})
+
+	return selectedTimeEntries, nil
+}
+
+// GetTimeEntriesOfAllClients returns the entries of the user without applying the filter,
+// e.g. the entries in the dummy project or in projects that are not synced
+func GetTimeEntriesOfAllClients(
+	config *config.Config, tmetricUser User, startDate string, endDate string,
+) ([]TimeEntry, error) {
+	httpClient := newHttpClient(*config)
 	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
 		Get(
 			fmt.Sprintf(
 				`%vaccounts/%v/timeentries?userId=%v&startDate=%v&endDate=%v`,
@@ -205,18 +245,38 @@ func GetAllTimeEntries(config *config.Config, tmetricUser User, startDate string
 	if err != nil {
 		return nil, fmt.Errorf("error parsing time entries response: %v\n", err)
 	}
+	return timeEntries, nil
+}
 
-	var timeEntriesOfTheSelectedClient []TimeEntry
-	for _, entry := range timeEntries {
-		if entry.Project.Client.Id == config.ClientIdInTmetric {
-			timeEntriesOfTheSelectedClient = append(timeEntriesOfTheSelectedClient, entry)
+// selectionMatches checks if the project or the client of the project is part of the selection.
+// Projects can be given by their id or their name
+func selectionMatches(selection config.EntrySelection, project Project) bool {
+	if slices.Contains(selection.ClientIds, project.Client.Id) {
+		return true
+	}
+	for _, selectedProject := range selection.Projects {
+		selectedProject = strings.TrimSpace(selectedProject)
+		if selectedProject == strconv.Itoa(project.Id) || strings.EqualFold(selectedProject, project.Name) {
+			return true
 		}
 	}
-	sort.Slice(timeEntriesOfTheSelectedClient, func(i, j int) bool {
-		return timeEntriesOfTheSelectedClient[i].StartTime < timeEntriesOfTheSelectedClient[j].StartTime
-	})
+	return false
+}
 
-	return timeEntriesOfTheSelectedClient, nil
+// selectTimeEntries returns the entries of the configured client and the ones selected by the filter,
+// without the excluded ones
+func selectTimeEntries(config *config.Config, timeEntries []TimeEntry) []TimeEntry {
+	included := config.EntryFilter.EntrySelection
+	if config.ClientIdInTmetric != 0 {
+		included.ClientIds = append(slices.Clone(included.ClientIds), config.ClientIdInTmetric)
+	}
+	var selectedTimeEntries []TimeEntry
+	for _, entry := range timeEntries {
+		if selectionMatches(included, entry.Project) && !selectionMatches(config.EntryFilter.Exclude, entry.Project) {
+			selectedTimeEntries = append(selectedTimeEntries, entry)
+		}
+	}
+	return selectedTimeEntries
 }
 
 func GetEntriesNotTransferredToOpenProject(timeEntries []TimeEntry, TmetricTagTransferredToOpenProject string) []TimeEntry {
@@ -237,6 +297,20 @@ func GetEntriesNotTransferredToOpenProject(timeEntries []TimeEntry, TmetricTagTr
 	return filteredEntries
 }
 
+// GetEntriesTransferredToOpenProject returns all entries that carry the tag of being transferred to OpenProject
+func GetEntriesTransferredToOpenProject(timeEntries []TimeEntry, TmetricTagTransferredToOpenProject string) []TimeEntry {
+	var transferredEntries []TimeEntry
+	for _, entry := range timeEntries {
+		for _, tag := range entry.Tags {
+			if tag.Name == TmetricTagTransferredToOpenProject {
+				transferredEntries = append(transferredEntries, entry)
+				break
+			}
+		}
+	}
+	return transferredEntries
+}
+
 func GetEntriesWithoutWorkType(timeEntries []TimeEntry) []TimeEntry {
 	// get all entries that belong to the client and do not have any work-type set
 	var entriesWithoutWorkType []TimeEntry
@@ -286,3 +360,51 @@ func GetAllAssignedWorkTypes(timeEntries []TimeEntry) []string {
 
 	return workTypes
 }
+
+// GroupBy is the property time entries are grouped by
+type GroupBy string
+
+const (
+	GroupByNote    GroupBy = "note"
+	GroupByProject GroupBy = "project"
+	GroupByTask    GroupBy = "task"
+)
+
+// GroupByOptions are all the properties time entries can be grouped by
+var GroupByOptions = []GroupBy{GroupByNote, GroupByProject, GroupByTask}
+
+// TimeEntryGroup are time entries with the same value of the property they are grouped by
+type TimeEntryGroup struct {
+	// Key is the value of the property as in the first entry of the group
+	Key     string
+	Entries []TimeEntry
+}
+
+// GroupTimeEntries groups the entries in the order they are found.
+// Surrounding spaces and the case do not matter when comparing the values
+func GroupTimeEntries(timeEntries []TimeEntry, groupBy GroupBy) ([]TimeEntryGroup, error) {
+	var groups []TimeEntryGroup
+	groupIndexes := map[string]int{}
+	for _, entry := range timeEntries {
+		var key string
+		switch groupBy {
+		case GroupByNote:
+			key = entry.Note
+		case GroupByProject:
+			key = entry.Project.Name
+		case GroupByTask:
+			key = entry.Task.Name
+		default:
+			return nil, fmt.Errorf("cannot group time entries by '%v'", groupBy)
+		}
+		key = strings.TrimSpace(key)
+		normalizedKey := strings.ToLower(key)
+		if index, found := groupIndexes[normalizedKey]; found {
+			groups[index].Entries = append(groups[index].Entries, entry)
+			continue
+		}
+		groupIndexes[normalizedKey] = len(groups)
+		groups = append(groups, TimeEntryGroup{Key: key, Entries: []TimeEntry{entry}})
+	}
+	return groups, nil
+}
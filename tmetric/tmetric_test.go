@@ -282,6 +282,31 @@ func Test_GetEntriesWithoutWorkType(t *testing.T) {
 	}
 }
 
+func Test_GetEntriesTransferredToOpenProject(t *testing.T) {
+	transferredEntry := TimeEntry{
+		Note: "transferred",
+		Tags: []Tag{
+			{Name: "Development", IsWorkType: true},
+			{Name: "transferred-to-openproject"},
+		},
+	}
+	notTransferredEntry := TimeEntry{
+		Note: "not transferred",
+		Tags: []Tag{{Name: "Development", IsWorkType: true}},
+	}
+	entryWithoutTags := TimeEntry{Note: "no tags"}
+	timeEntries := []TimeEntry{notTransferredEntry, transferredEntry, entryWithoutTags}
+
+	result := GetEntriesTransferredToOpenProject(timeEntries, "transferred-to-openproject")
+	if !reflect.DeepEqual(result, []TimeEntry{transferredEntry}) {
+		t.Errorf("got %v, want %v", result, []TimeEntry{transferredEntry})
+	}
+	result = GetEntriesNotTransferredToOpenProject(timeEntries, "transferred-to-openproject")
+	if !reflect.DeepEqual(result, []TimeEntry{notTransferredEntry, entryWithoutTags}) {
+		t.Errorf("got %v, want %v", result, []TimeEntry{notTransferredEntry, entryWithoutTags})
+	}
+}
+
 func Test_getPossibleWorkTypes(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -353,3 +378,207 @@ func Test_getPossibleWorkTypes(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetAllClients(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockResponse   string
+		mockStatusCode int
+		expectedResult []ClientV2
+		expectError    bool
+	}{
+		{
+			name:           "successful response",
+			mockResponse:   `[{"clientId":1,"clientName":"Client1"},{"clientId":2,"clientName":"Client2"}]`,
+			mockStatusCode: http.StatusOK,
+			expectedResult: []ClientV2{{Id: 1, Name: "Client1"}, {Id: 2, Name: "Client2"}},
+		},
+		{
+			name:           "error response",
+			mockResponse:   `Internal Server Error`,
+			mockStatusCode: http.StatusInternalServerError,
+			expectedResult: nil,
+			expectError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestPath string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestPath = r.URL.Path
+				w.WriteHeader(tt.mockStatusCode)
+				w.Write([]byte(tt.mockResponse))
+			}))
+			defer mockServer.Close()
+			config := config.Config{
+				TmetricToken:      "dummyToken",
+				TmetricAPIBaseUrl: mockServer.URL + "/",
+			}
+			result, err := GetAllClients(&config, User{ActiveAccountId: 1})
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error: %v, got: %v", tt.expectError, err)
+			}
+			if !reflect.DeepEqual(result, tt.expectedResult) {
+				t.Errorf("expected result: %v, got: %v", tt.expectedResult, result)
+			}
+			if requestPath != "/accounts/1/clients" {
+				t.Errorf("expected request path: /accounts/1/clients, got: %v", requestPath)
+			}
+		})
+	}
+}
+
+func Test_GetAllTags(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(
+			`[{"tagId":1,"tagName":"transferred-to-openproject","isWorkType":false},{"tagId":2,"tagName":"Development","isWorkType":true}]`,
+		))
+	}))
+	defer mockServer.Close()
+	config := config.Config{
+		TmetricToken:      "dummyToken",
+		TmetricAPIBaseUrl: mockServer.URL + "/",
+	}
+
+	tags, err := GetAllTags(&config, User{ActiveAccountId: 1})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expectedTags := []Tag{
+		{Id: 1, Name: "transferred-to-openproject", IsWorkType: false},
+		{Id: 2, Name: "Development", IsWorkType: true},
+	}
+	if !reflect.DeepEqual(tags, expectedTags) {
+		t.Errorf("expected result: %v, got: %v", expectedTags, tags)
+	}
+	workTypes, err := GetAllWorkTypes(&config, User{ActiveAccountId: 1})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(workTypes, expectedTags[1:]) {
+		t.Errorf("expected result: %v, got: %v", expectedTags[1:], workTypes)
+	}
+}
+
+func Test_selectTimeEntries(t *testing.T) {
+	clientA := Client{Id: 1, Name: "Client A"}
+	clientB := Client{Id: 2, Name: "Client B"}
+	website := TimeEntry{Id: 1, Project: Project{Id: 10, Name: "Website", Client: clientA}}
+	internal := TimeEntry{Id: 2, Project: Project{Id: 11, Name: "Internal", Client: clientA}}
+	app := TimeEntry{Id: 3, Project: Project{Id: 20, Name: "App", Client: clientB}}
+	noClient := TimeEntry{Id: 4, Project: Project{Id: 30, Name: "Research"}}
+	timeEntries := []TimeEntry{website, internal, app, noClient}
+
+	tests := []struct {
+		name     string
+		config   config.Config
+		expected []TimeEntry
+	}{
+		{
+			name:     "only the configured client",
+			config:   config.Config{ClientIdInTmetric: 1},
+			expected: []TimeEntry{website, internal},
+		},
+		{
+			name: "configured client and clients of the filter",
+			config: config.Config{
+				ClientIdInTmetric: 1,
+				EntryFilter:       config.EntryFilter{EntrySelection: config.EntrySelection{ClientIds: []int{2}}},
+			},
+			expected: []TimeEntry{website, internal, app},
+		},
+		{
+			name: "projects by id and by name",
+			config: config.Config{
+				EntryFilter: config.EntryFilter{EntrySelection: config.EntrySelection{Projects: []string{"20", "research"}}},
+			},
+			expected: []TimeEntry{app, noClient},
+		},
+		{
+			name: "excluded projects are skipped even if their client is selected",
+			config: config.Config{
+				EntryFilter: config.EntryFilter{
+					EntrySelection: config.EntrySelection{ClientIds: []int{1, 2}},
+					Exclude:        config.EntrySelection{Projects: []string{"Internal"}},
+				},
+			},
+			expected: []TimeEntry{website, app},
+		},
+		{
+			name: "excluded clients are skipped even if their project is selected",
+			config: config.Config{
+				ClientIdInTmetric: 1,
+				EntryFilter: config.EntryFilter{
+					EntrySelection: config.EntrySelection{Projects: []string{"App"}},
+					Exclude:        config.EntrySelection{ClientIds: []int{2}},
+				},
+			},
+			expected: []TimeEntry{website, internal},
+		},
+		{
+			name:     "nothing selected",
+			config:   config.Config{},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := selectTimeEntries(&tt.config, timeEntries)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("expected result: %v, got: %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGroupTimeEntries(t *testing.T) {
+	timeEntries := []TimeEntry{
+		{Id: 1, Note: "Weekly ", Project: Project{Name: "Internal"}, Task: Task{Name: "Meetings"}},
+		{Id: 2, Note: "coding", Project: Project{Name: "Product"}},
+		{Id: 3, Note: "weekly", Project: Project{Name: "Product"}, Task: Task{Name: "meetings"}},
+	}
+	tests := []struct {
+		groupBy  GroupBy
+		expected []TimeEntryGroup
+	}{
+		{
+			groupBy: GroupByNote,
+			expected: []TimeEntryGroup{
+				{Key: "Weekly", Entries: []TimeEntry{timeEntries[0], timeEntries[2]}},
+				{Key: "coding", Entries: []TimeEntry{timeEntries[1]}},
+			},
+		},
+		{
+			groupBy: GroupByProject,
+			expected: []TimeEntryGroup{
+				{Key: "Internal", Entries: []TimeEntry{timeEntries[0]}},
+				{Key: "Product", Entries: []TimeEntry{timeEntries[1], timeEntries[2]}},
+			},
+		},
+		{
+			groupBy: GroupByTask,
+			expected: []TimeEntryGroup{
+				{Key: "Meetings", Entries: []TimeEntry{timeEntries[0], timeEntries[2]}},
+				{Key: "", Entries: []TimeEntry{timeEntries[1]}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.groupBy), func(t *testing.T) {
+			groups, err := GroupTimeEntries(timeEntries, tt.groupBy)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(groups, tt.expected) {
+				t.Errorf("got %v, want %v", groups, tt.expected)
+			}
+		})
+	}
+
+	_, err := GroupTimeEntries(timeEntries, "client")
+	if err == nil || err.Error() != "cannot group time entries by 'client'" {
+		t.Errorf("got error %v, want an error for the unknown property", err)
+	}
+}
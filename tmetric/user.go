@@ -21,8 +21,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
-	"github.com/go-resty/resty/v2"
-	"os"
 	"regexp"
 )
 
@@ -50,39 +48,31 @@ type UserV2 struct {
 	} `json:"accountMemberScope"`
 }
 
-func NewUser() User {
-	config := config.NewConfig()
-
-	httpClient := resty.New()
+// NewUser returns the tmetric user the token in the configuration belongs to
+func NewUser(config *config.Config) (User, error) {
+	httpClient := newHttpClient(*config)
 
 	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
 		Get(config.TmetricAPIV3BaseUrl + "user")
 	if err != nil || resp.StatusCode() != 200 {
-		fmt.Fprintf(os.Stderr, "cannot reach tmetric server\n")
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		} else {
-			fmt.Fprintf(os.Stderr, "status code: %v\n", resp.StatusCode())
-		}
-		os.Exit(1)
+		return User{}, fmt.Errorf(
+			"cannot reach tmetric server. Error: '%v'. HTTP status code: %v", err, resp.StatusCode(),
+		)
 	}
 	var user User
 	err = json.Unmarshal(resp.Body(), &user)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error parsing response: %v\n", err)
-		os.Exit(1)
+		return User{}, fmt.Errorf("error parsing user response: %v", err)
 	}
 
-	return user
+	return user, nil
 }
 
 // FindUserByName searches for users that match the given search and returns the first match.
 func FindUserByName(config *config.Config, userMe User, search string) (User, error) {
-	httpClient := resty.New()
+	httpClient := newHttpClient(*config)
 
 	resp, err := httpClient.R().
-		SetAuthToken(config.TmetricToken).
 		Get(fmt.Sprintf("%vaccounts/%v/members", config.TmetricAPIBaseUrl, userMe.ActiveAccountId))
 	if err != nil || resp.StatusCode() != 200 {
 		return User{}, fmt.Errorf(
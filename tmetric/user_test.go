@@ -135,3 +135,56 @@ func TestFindUserByName(t *testing.T) {
 		})
 	}
 }
+
+func TestNewUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockResponse   string
+		mockStatusCode int
+		want           User
+		wantErrMessage string
+	}{
+		{
+			name:           "valid user",
+			mockResponse:   `{"id": 1234, "name": "admin user", "activeAccountId": 4567}`,
+			mockStatusCode: http.StatusOK,
+			want:           User{Id: 1234, Name: "admin user", ActiveAccountId: 4567},
+		},
+		{
+			name:           "wrong token",
+			mockResponse:   `{"message": "Unauthorized"}`,
+			mockStatusCode: http.StatusUnauthorized,
+			wantErrMessage: "cannot reach tmetric server. Error: '<nil>'. HTTP status code: 401",
+		},
+		{
+			name:           "wrongly formatted response",
+			mockResponse:   `{[],]}`,
+			mockStatusCode: http.StatusOK,
+			wantErrMessage: "error parsing user response",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestPath string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestPath = r.URL.Path
+				w.WriteHeader(tt.mockStatusCode)
+				w.Write([]byte(tt.mockResponse))
+			}))
+			defer mockServer.Close()
+			config := config.Config{
+				TmetricToken:        "dummyToken",
+				TmetricAPIV3BaseUrl: mockServer.URL + "/",
+			}
+
+			got, err := NewUser(&config)
+			if tt.wantErrMessage != "" {
+				assert.ErrorContains(t, err, tt.wantErrMessage)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, "/user", requestPath)
+		})
+	}
+}
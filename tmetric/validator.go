@@ -0,0 +1,293 @@
+package tmetric
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+)
+
+// the names of the validators, they tell which problem was found
+const (
+	ValidatorRunningTimer       = "running timer"
+	ValidatorEndBeforeStart     = "end before start"
+	ValidatorDuration           = "duration"
+	ValidatorOverlap            = "overlap"
+	ValidatorMidnight           = "spans midnight"
+	ValidatorEmptyNote          = "empty note"
+	ValidatorDisallowedWorkType = "disallowed work type"
+)
+
+// Severity tells how bad a problem is
+type Severity string
+
+const (
+	// SeverityError is a problem that has to be fixed before the entry can be transferred correctly
+	SeverityError Severity = "error"
+	// SeverityWarning is a problem that might be intended, e.g. a long entry. It's reported, but nothing has to be fixed
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is something a validator found wrong with a time entry
+type Problem struct {
+	Entry TimeEntry
+	// Validator is the name of the validator that found the problem
+	Validator string
+	Message   string
+	Severity  Severity
+	// CheckFailed is set if the validator could not check the entry, e.g. because OpenProject could not be reached
+	CheckFailed bool
+}
+
+// Validator checks time entries. It only returns an error if it could not do the check at all,
+// entries that cannot be checked are reported as a problem
+type Validator interface {
+	Name() string
+	Validate(timeEntries []TimeEntry) ([]Problem, error)
+}
+
+// entryValidator checks every entry on its own, check returns an empty message if the entry is fine
+type entryValidator struct {
+	name  string
+	check func(entry TimeEntry) (string, Severity)
+}
+
+func (v entryValidator) Name() string {
+	return v.name
+}
+
+func (v entryValidator) Validate(timeEntries []TimeEntry) ([]Problem, error) {
+	var problems []Problem
+	for _, entry := range timeEntries {
+		if message, severity := v.check(entry); message != "" {
+			problems = append(problems, Problem{Entry: entry, Validator: v.name, Message: message, Severity: severity})
+		}
+	}
+	return problems, nil
+}
+
+// NewRunningTimerValidator finds entries without an end time. They cannot be transferred to OpenProject
+func NewRunningTimerValidator() Validator {
+	return entryValidator{name: ValidatorRunningTimer, check: func(entry TimeEntry) (string, Severity) {
+		if entry.EndTime == "" {
+			return "the timer is still running, stop it in tmetric", SeverityError
+		}
+		return "", ""
+	}}
+}
+
+// NewEndBeforeStartValidator finds entries that end before they start or whose times cannot be read
+func NewEndBeforeStartValidator() Validator {
+	return entryValidator{name: ValidatorEndBeforeStart, check: func(entry TimeEntry) (string, Severity) {
+		if entry.EndTime == "" {
+			return "", ""
+		}
+		if _, err := entry.GetDuration(); err != nil {
+			return err.Error(), SeverityError
+		}
+		return "", ""
+	}}
+}
+
+// NewDurationValidator finds entries without a duration and entries that are longer than maxDuration.
+// A maxDuration of 0 only finds the entries without a duration
+func NewDurationValidator(maxDuration time.Duration) Validator {
+	return entryValidator{name: ValidatorDuration, check: func(entry TimeEntry) (string, Severity) {
+		if entry.EndTime == "" {
+			return "", ""
+		}
+		duration, err := entry.GetDuration()
+		switch {
+		case err != nil:
+			return "", ""
+		case duration == 0:
+			return "the entry has no duration", SeverityError
+		case maxDuration > 0 && duration > maxDuration:
+			// the entry might have been forgotten to stop, but it might as well be a long day
+			return fmt.Sprintf("the entry is longer than %v", maxDuration), SeverityWarning
+		}
+		return "", ""
+	}}
+}
+
+// NewMidnightValidator finds entries that end on another day than they start
+func NewMidnightValidator() Validator {
+	return entryValidator{name: ValidatorMidnight, check: func(entry TimeEntry) (string, Severity) {
+		start, startErr := entry.getParsedTime(true)
+		end, endErr := entry.getParsedTime(false)
+		if startErr != nil || endErr != nil || !end.After(start) {
+			return "", ""
+		}
+		// an entry that ends at exactly midnight still belongs to the day it started
+		if start.Format("2006-01-02") != end.Add(-time.Nanosecond).Format("2006-01-02") {
+			return "the entry spans midnight, OpenProject will count all of it on the day it started", SeverityWarning
+		}
+		return "", ""
+	}}
+}
+
+// NewEmptyNoteValidator finds entries without a note
+func NewEmptyNoteValidator() Validator {
+	return entryValidator{name: ValidatorEmptyNote, check: func(entry TimeEntry) (string, Severity) {
+		if strings.TrimSpace(entry.Note) == "" {
+			return "the entry has no note", SeverityError
+		}
+		return "", ""
+	}}
+}
+
+type overlapValidator struct{}
+
+// NewOverlapValidator finds entries that start before an earlier entry ended
+func NewOverlapValidator() Validator {
+	return overlapValidator{}
+}
+
+func (v overlapValidator) Name() string {
+	return ValidatorOverlap
+}
+
+func (v overlapValidator) Validate(timeEntries []TimeEntry) ([]Problem, error) {
+	type timedEntry struct {
+		entry      TimeEntry
+		start, end time.Time
+	}
+	var timedEntries []timedEntry
+	for _, entry := range timeEntries {
+		start, startErr := entry.getParsedTime(true)
+		end, endErr := entry.getParsedTime(false)
+		// running timers and broken times are reported by the other validators
+		if startErr != nil || endErr != nil || end.Before(start) {
+			continue
+		}
+		timedEntries = append(timedEntries, timedEntry{entry: entry, start: start, end: end})
+	}
+	sort.SliceStable(timedEntries, func(i, j int) bool {
+		return timedEntries[i].start.Before(timedEntries[j].start)
+	})
+
+	var problems []Problem
+	// latest is the entry that ends last of all the entries that started before the current one
+	var latest *timedEntry
+	for i := range timedEntries {
+		current := &timedEntries[i]
+		if latest != nil && current.start.Before(latest.end) {
+			problems = append(problems, Problem{
+				Entry:     current.entry,
+				Validator: ValidatorOverlap,
+				Message: fmt.Sprintf(
+					"the entry overlaps with '%v' %v-%v",
+					latest.entry.Note, latest.entry.StartTime, latest.entry.EndTime,
+				),
+				// working on two things at the same time can be intended
+				Severity: SeverityWarning,
+			})
+		}
+		if latest == nil || current.end.After(latest.end) {
+			latest = current
+		}
+	}
+	return problems, nil
+}
+
+type disallowedWorkTypeValidator struct {
+	config        *config.Config
+	activityCache *openproject.ActivityCache
+}
+
+// NewDisallowedWorkTypeValidator finds entries whose work type cannot be mapped to an activity
+// that is allowed in the project of the linked work package
+func NewDisallowedWorkTypeValidator(config *config.Config, activityCache *openproject.ActivityCache) Validator {
+	return disallowedWorkTypeValidator{config: config, activityCache: activityCache}
+}
+
+func (v disallowedWorkTypeValidator) Name() string {
+	return ValidatorDisallowedWorkType
+}
+
+func (v disallowedWorkTypeValidator) Validate(timeEntries []TimeEntry) ([]Problem, error) {
+	notLinked := map[int]bool{}
+	for _, entry := range GetEntriesWithoutLinkToOpenProject(v.config, timeEntries) {
+		notLinked[entry.Id] = true
+	}
+	var checkedEntries []TimeEntry
+	var workPackageIds []int
+	for _, entry := range timeEntries {
+		if notLinked[entry.Id] {
+			continue
+		}
+		if _, err := entry.GetWorkType(); err != nil {
+			continue
+		}
+		workPackageId, _ := entry.GetIssueIdAsInt()
+		checkedEntries = append(checkedEntries, entry)
+		workPackageIds = append(workPackageIds, workPackageId)
+	}
+	// without the prefetched projects every work package is looked up on its own,
+	// so the entries whose work package cannot be looked up are found and reported below
+	_ = v.activityCache.Prefetch(*v.config, workPackageIds)
+
+	var problems []Problem
+	lookupErrors := map[int]error{}
+	for i, entry := range checkedEntries {
+		workPackageId := workPackageIds[i]
+		err, lookupFailed := lookupErrors[workPackageId]
+		if !lookupFailed {
+			workType, _ := entry.GetWorkType()
+			_, err = v.activityCache.NewActivityFromWorkType(*v.config, workPackageId, workType)
+		}
+		var unmappedWorkTypeError openproject.UnmappedWorkTypeError
+		if errors.As(err, &unmappedWorkTypeError) {
+			problems = append(problems, Problem{
+				Entry:     entry,
+				Validator: ValidatorDisallowedWorkType,
+				Message:   strings.TrimSpace(unmappedWorkTypeError.Error()),
+				Severity:  SeverityError,
+			})
+		} else if err != nil {
+			// don't request a work package again that could not be looked up
+			lookupErrors[workPackageId] = err
+			problems = append(problems, Problem{
+				Entry:     entry,
+				Validator: ValidatorDisallowedWorkType,
+				Message: fmt.Sprintf(
+					"the work type could not be checked for work package #%v: %v",
+					workPackageId, strings.TrimSpace(err.Error()),
+				),
+				Severity:    SeverityError,
+				CheckFailed: true,
+			})
+		}
+	}
+	return problems, nil
+}
+
+// DefaultValidators are the validators 'check tmetric' runs in addition to the checks for a work package and a work type
+func DefaultValidators(config *config.Config, activityCache *openproject.ActivityCache) []Validator {
+	return []Validator{
+		NewRunningTimerValidator(),
+		NewEndBeforeStartValidator(),
+		NewDurationValidator(config.TmetricMaxEntryDuration),
+		NewOverlapValidator(),
+		NewMidnightValidator(),
+		NewEmptyNoteValidator(),
+		NewDisallowedWorkTypeValidator(config, activityCache),
+	}
+}
+
+// Validate runs all the validators and returns the problems in the order of the validators
+func Validate(timeEntries []TimeEntry, validators []Validator) ([]Problem, error) {
+	var problems []Problem
+	for _, validator := range validators {
+		validatorProblems, err := validator.Validate(timeEntries)
+		if err != nil {
+			return nil, fmt.Errorf("could not check for '%v': %v", validator.Name(), err)
+		}
+		problems = append(problems, validatorProblems...)
+	}
+	return problems, nil
+}
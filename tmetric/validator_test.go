@@ -0,0 +1,120 @@
+package tmetric
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JankariTech/OpenProjectTmetricIntegration/config"
+	"github.com/JankariTech/OpenProjectTmetricIntegration/openproject"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	timeEntries := []TimeEntry{
+		{Id: 1, Note: "fine", StartTime: "2024-05-10T08:00:00", EndTime: "2024-05-10T09:00:00"},
+		{Id: 2, Note: "running", StartTime: "2024-05-10T16:00:00"},
+		{Id: 3, Note: "backwards", StartTime: "2024-05-10T12:00:00", EndTime: "2024-05-10T11:00:00"},
+		{Id: 4, Note: "empty", StartTime: "2024-05-10T13:00:00", EndTime: "2024-05-10T13:00:00"},
+		{Id: 5, Note: "forgotten", StartTime: "2024-05-11T08:00:00", EndTime: "2024-05-11T20:00:00"},
+		{Id: 6, Note: "overlapping", StartTime: "2024-05-10T08:30:00", EndTime: "2024-05-10T09:30:00"},
+		{Id: 7, Note: " ", StartTime: "2024-05-12T23:00:00", EndTime: "2024-05-13T01:00:00"},
+		{Id: 8, Note: "till midnight", StartTime: "2024-05-13T23:00:00", EndTime: "2024-05-14T00:00:00"},
+	}
+	validators := []Validator{
+		NewRunningTimerValidator(),
+		NewEndBeforeStartValidator(),
+		NewDurationValidator(10 * time.Hour),
+		NewOverlapValidator(),
+		NewMidnightValidator(),
+		NewEmptyNoteValidator(),
+	}
+
+	problems, err := Validate(timeEntries, validators)
+	assert.NoError(t, err)
+	var found []string
+	for _, problem := range problems {
+		found = append(
+			found, string(problem.Severity)+": "+problem.Validator+": "+problem.Entry.Note+": "+problem.Message,
+		)
+	}
+	assert.Equal(t, []string{
+		"error: running timer: running: the timer is still running, stop it in tmetric",
+		"error: end before start: backwards: end time is before start time",
+		"error: duration: empty: the entry has no duration",
+		"warning: duration: forgotten: the entry is longer than 10h0m0s",
+		"warning: overlap: overlapping: the entry overlaps with 'fine' 2024-05-10T08:00:00-2024-05-10T09:00:00",
+		"warning: spans midnight:  : the entry spans midnight, OpenProject will count all of it on the day it started",
+		"error: empty note:  : the entry has no note",
+	}, found)
+}
+
+func TestNewDurationValidator_withoutMaximum(t *testing.T) {
+	problems, err := NewDurationValidator(0).Validate([]TimeEntry{
+		{Note: "long", StartTime: "2024-05-10T00:00:00", EndTime: "2024-05-10T23:00:00"},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestNewDisallowedWorkTypeValidator(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/work_packages") {
+			w.Write([]byte(`{"_embedded":{"elements":[{"id":1234,"_links":{"project":{"href":"/api/v3/projects/3"}}}]}}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		// the work package 999 cannot be looked up
+		if strings.Contains(string(body), "/work_packages/999") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"_embedded":{"schema":{"activity":{"_embedded":{"allowedValues":[
+			{"id":1,"name":"Development"}
+		]}}}}}`))
+	}))
+	defer mockServer.Close()
+	config := config.Config{
+		OpenProjectUrl:          mockServer.URL,
+		OpenProjectToken:        "dummyToken",
+		TmetricExternalTaskLink: mockServer.URL + "/",
+	}
+	linkedTask := Task{
+		Id:           42,
+		ExternalLink: ExternalLink{IssueId: "#1234", Link: mockServer.URL + "/work_packages/1234"},
+	}
+	timeEntries := []TimeEntry{
+		{Id: 1, Note: "allowed", Task: linkedTask, Tags: []Tag{{Name: "Development", IsWorkType: true}}},
+		{Id: 2, Note: "not allowed", Task: linkedTask, Tags: []Tag{{Name: "Support", IsWorkType: true}}},
+		{Id: 3, Note: "no work type", Task: linkedTask},
+		{Id: 4, Note: "not linked", Tags: []Tag{{Name: "Support", IsWorkType: true}}},
+		{
+			Id:   5,
+			Note: "unknown work package",
+			Task: Task{
+				Id:           43,
+				ExternalLink: ExternalLink{IssueId: "#999", Link: mockServer.URL + "/work_packages/999"},
+			},
+			Tags: []Tag{{Name: "Development", IsWorkType: true}},
+		},
+	}
+
+	problems, err := NewDisallowedWorkTypeValidator(&config, openproject.NewActivityCache()).Validate(timeEntries)
+	assert.NoError(t, err)
+	if assert.Len(t, problems, 2) {
+		assert.Equal(t, Problem{
+			Entry:     timeEntries[1],
+			Validator: ValidatorDisallowedWorkType,
+			Message:   "Work Type 'Support' is not a valid activity in OpenProject",
+			Severity:  SeverityError,
+		}, problems[0])
+		// the other entries are still checked
+		assert.Equal(t, timeEntries[4], problems[1].Entry)
+		assert.True(t, problems[1].CheckFailed)
+		assert.Equal(t, SeverityError, problems[1].Severity)
+		assert.Contains(t, problems[1].Message, "could not be checked for work package #999")
+	}
+}